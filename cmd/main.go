@@ -2,13 +2,29 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/ojkelly/xray-to-otel/exporter"
 )
 
 func main() {
-	ctx := context.Background()
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		backfill(os.Args[2:])
+		return
+	}
+
+	// stop polling on SIGTERM, from ECS replacing the task, or ctrl-c, and
+	// give what's in flight a chance to be exported.
+	// Exits 0 once everything has been exported, or 1 if it couldn't be.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	svc, err := exporter.New(ctx)
 
 	if err != nil {
@@ -25,3 +41,57 @@ func main() {
 
 	log.Println("Finished")
 }
+
+// backfill exports traces for a past time range, then exits
+//
+//	xotel backfill --from 24h
+//	xotel backfill --from 2022-07-01T09:00:00Z --to 2022-07-01T12:00:00Z
+func backfill(args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fromFlag := flags.String("from", "", "start of the range, as RFC3339 or a duration ago like 24h")
+	toFlag := flags.String("to", "0s", "end of the range, as RFC3339 or a duration ago, defaults to now")
+	window := flags.Duration("window", time.Hour, "how much time to query X-Ray for at once, at most 6h")
+	flags.Parse(args)
+
+	now := time.Now()
+	from, err := parseTime(now, *fromFlag)
+	if err != nil {
+		log.Fatalf("ERROR: --from %s\n", err)
+	}
+	to, err := parseTime(now, *toFlag)
+	if err != nil {
+		log.Fatalf("ERROR: --to %s\n", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	svc, err := exporter.New(ctx)
+	if err != nil {
+		log.Fatalf("ERROR: %s\n", err)
+	}
+
+	err = svc.Backfill(ctx, from, to, *window)
+	if err != nil {
+		log.Fatalf("ERROR: %s\n", err)
+	}
+
+	log.Println("Finished backfill")
+}
+
+// parseTime accepts either a timestamp or how long ago
+func parseTime(now time.Time, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("is required")
+	}
+
+	if ago, err := time.ParseDuration(value); err == nil {
+		return now.Add(ago * -1), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be RFC3339 or a duration: %s", err)
+	}
+	return t, nil
+}
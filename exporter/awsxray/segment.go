@@ -182,9 +182,15 @@ type CauseObject struct {
 
 // UnmarshalJSON is the custom unmarshaller for the cause field
 func (c *CauseData) UnmarshalJSON(data []byte) error {
-	err := json.Unmarshal(data, &c.CauseObject)
+	var obj struct {
+		Message *string `json:"message"`
+		CauseObject
+	}
+	err := json.Unmarshal(data, &obj)
 	if err == nil {
 		c.Type = CauseTypeObject
+		c.Message = obj.Message
+		c.CauseObject = obj.CauseObject
 		return nil
 	}
 	rawStr := string(data)
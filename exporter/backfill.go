@@ -0,0 +1,107 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// X-Ray won't return trace summaries for a longer range than this
+const maxXrayWindow = 6 * time.Hour
+
+// Backfill exports every trace between from and to in windows of at most
+// window for each pipeline in each region, then returns. It doesn't read or
+// update the checkpoint. If ctx is done it finishes the current window and
+// stops early.
+func (svc *Service) Backfill(ctx context.Context, from time.Time, to time.Time, window time.Duration) error {
+	if !from.Before(to) {
+		return fmt.Errorf("backfill start %s is not before end %s", from, to)
+	}
+	if window <= 0 || window > maxXrayWindow {
+		window = maxXrayWindow
+	}
+
+	// every source and pipeline pair to backfill
+	type target struct {
+		src *source
+		pl  *pipeline
+	}
+	targets := []target{}
+	for _, src := range svc.sources {
+		pipelines := append([]*pipeline{}, svc.pipelines...)
+		if svc.cfg.PollGroups {
+			groupPipelines, err := svc.groupPipelines(ctx, src)
+			if err != nil {
+				return fmt.Errorf("unable to get xray groups in %s: %s", src.region, err)
+			}
+			pipelines = append(pipelines, groupPipelines...)
+		}
+
+		for _, pl := range pipelines {
+			targets = append(targets, target{src: src, pl: pl})
+		}
+	}
+
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	reportCtx, cancelReport := context.WithCancel(context.Background())
+	defer cancelReport()
+
+	svc.startPipeline(workCtx)
+	go svc.report(reportCtx)
+
+	total := int(to.Sub(from) / window)
+	if to.Sub(from)%window != 0 {
+		total++
+	}
+	log.Printf("Backfilling %s to %s in (%d) windows\n", from.Format(time.RFC3339), to.Format(time.RFC3339), total)
+
+	var failed int
+	for i, start := 1, from; start.Before(to); i, start = i+1, start.Add(window) {
+		if ctx.Err() != nil {
+			log.Printf("Backfill stopped at %s\n", start.Format(time.RFC3339))
+			break
+		}
+
+		end := start.Add(window)
+		if end.After(to) {
+			end = to
+		}
+
+		for _, t := range targets {
+			w := &pollWindow{source: t.src, pipeline: t.pl, start: start, end: end}
+			err := svc.collectAndForwardTraces(workCtx, w)
+			w.pending.Wait()
+
+			if err == nil && w.hasFailed() {
+				err = fmt.Errorf("failed to export all traces")
+			}
+			if err != nil {
+				failed++
+				log.Printf(
+					"Backfill of %s from %s to %s failed: %s\n",
+					w.key(), start.Format(time.RFC3339), end.Format(time.RFC3339), err,
+				)
+			}
+		}
+
+		log.Printf("Backfilled (%d/%d) windows, up to %s\n", i, total, end.Format(time.RFC3339))
+	}
+
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), svc.cfg.ShutdownTimeout)
+	defer cancelStop()
+	err := svc.stopDestinations(stopCtx)
+	if err != nil {
+		return err
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("(%d/%d) backfill windows failed", failed, total*len(targets))
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("backfill was interrupted before %s", to.Format(time.RFC3339))
+	}
+	return nil
+}
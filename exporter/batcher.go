@@ -0,0 +1,197 @@
+package exporter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// batcher collects converted segments for a destination and uploads them
+// together, instead of making a call for every segment
+type batcher struct {
+	maxSpans int
+	maxBytes int
+	maxDelay time.Duration
+	upload   func(ctx context.Context, rspans []*tracepb.ResourceSpans) error
+
+	mu      sync.Mutex
+	pending *batch
+	batches chan *batch
+	// batches that have been cut but not finished uploading
+	inflight sync.WaitGroup
+}
+
+// batch is a set of segments uploaded in one call, done is called for
+// each of them with the result
+type batch struct {
+	rspans []*tracepb.ResourceSpans
+	done   []func(error)
+	spans  int
+	bytes  int
+	timer  *time.Timer
+}
+
+func newBatcher(cfg Config, upload func(ctx context.Context, rspans []*tracepb.ResourceSpans) error) *batcher {
+	return &batcher{
+		maxSpans: cfg.BatchMaxSpans,
+		maxBytes: cfg.BatchMaxBytes,
+		maxDelay: cfg.BatchMaxDelay,
+		upload:   upload,
+		batches:  make(chan *batch, cfg.UploadWorkers),
+	}
+}
+
+// start uploads batches with n workers
+func (b *batcher) start(ctx context.Context, n int) {
+	startWorkers(n, func() {
+		for bt := range b.batches {
+			err := b.upload(ctx, mergeResourceSpans(bt.rspans))
+			for _, done := range bt.done {
+				done(err)
+			}
+			b.inflight.Done()
+		}
+	})
+}
+
+// add queues rspans for the next batch, done is called once it's been
+// uploaded. It blocks while the upload workers are busy.
+func (b *batcher) add(rspans *tracepb.ResourceSpans, done func(error)) {
+	spans := countSpans(rspans)
+	size := proto.Size(rspans)
+
+	b.mu.Lock()
+	var full []*batch
+	// cut what we have first if this wouldn't fit
+	if b.pending != nil && b.maxBytes > 0 && b.pending.bytes+size > b.maxBytes {
+		full = append(full, b.cut())
+	}
+
+	if b.pending == nil {
+		bt := &batch{}
+		bt.timer = time.AfterFunc(b.maxDelay, func() { b.flushBatch(bt) })
+		b.pending = bt
+	}
+	b.pending.rspans = append(b.pending.rspans, rspans)
+	b.pending.done = append(b.pending.done, done)
+	b.pending.spans += spans
+	b.pending.bytes += size
+
+	if b.pending.spans >= b.maxSpans || (b.maxBytes > 0 && b.pending.bytes >= b.maxBytes) {
+		full = append(full, b.cut())
+	}
+	b.mu.Unlock()
+
+	for _, bt := range full {
+		b.batches <- bt
+	}
+}
+
+// cut takes the pending batch to be uploaded, b.mu must be held
+func (b *batcher) cut() *batch {
+	bt := b.pending
+	bt.timer.Stop()
+	b.pending = nil
+	b.inflight.Add(1)
+	return bt
+}
+
+// flushBatch uploads bt when max delay is up, if it hasn't already been cut
+func (b *batcher) flushBatch(bt *batch) {
+	b.mu.Lock()
+	if b.pending != bt {
+		b.mu.Unlock()
+		return
+	}
+	b.cut()
+	b.mu.Unlock()
+
+	b.batches <- bt
+}
+
+// flush uploads anything pending, and waits for every batch to finish
+// uploading or ctx to be done
+func (b *batcher) flush(ctx context.Context) {
+	b.mu.Lock()
+	bt := b.pending
+	if bt != nil {
+		b.cut()
+	}
+	b.mu.Unlock()
+
+	if bt != nil {
+		select {
+		case b.batches <- bt:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func countSpans(rspans *tracepb.ResourceSpans) int {
+	n := 0
+	for _, ss := range rspans.ScopeSpans {
+		n += len(ss.Spans)
+	}
+	return n
+}
+
+// mergeResourceSpans combines ResourceSpans with the same resource, and
+// their ScopeSpans with the same scope, so each is only sent once
+func mergeResourceSpans(all []*tracepb.ResourceSpans) []*tracepb.ResourceSpans {
+	merged := []*tracepb.ResourceSpans{}
+	byResource := map[string]*tracepb.ResourceSpans{}
+	byScope := map[string]*tracepb.ScopeSpans{}
+
+	for _, rs := range all {
+		rkey := rs.SchemaUrl + "\x00" + attributesKey(rs.Resource.GetAttributes())
+
+		target, ok := byResource[rkey]
+		if !ok {
+			target = &tracepb.ResourceSpans{Resource: rs.Resource, SchemaUrl: rs.SchemaUrl}
+			byResource[rkey] = target
+			merged = append(merged, target)
+		}
+
+		for _, ss := range rs.ScopeSpans {
+			skey := rkey + "\x00" + ss.SchemaUrl + "\x00" + ss.Scope.GetName() + "\x00" + ss.Scope.GetVersion()
+
+			scope, ok := byScope[skey]
+			if !ok {
+				scope = &tracepb.ScopeSpans{Scope: ss.Scope, SchemaUrl: ss.SchemaUrl}
+				byScope[skey] = scope
+				target.ScopeSpans = append(target.ScopeSpans, scope)
+			}
+			scope.Spans = append(scope.Spans, ss.Spans...)
+		}
+	}
+
+	return merged
+}
+
+// attributesKey is the same for any two sets of equal attributes,
+// regardless of their order
+func attributesKey(attrs []*commonpb.KeyValue) string {
+	sorted := append([]*commonpb.KeyValue{}, attrs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	d, _ := proto.MarshalOptions{Deterministic: true}.Marshal(&resourcepb.Resource{Attributes: sorted})
+	return string(d)
+}
@@ -0,0 +1,131 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the last window that was fully exported, the next poll
+// starts from EndTime.
+type Checkpoint struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// CheckpointStore persists checkpoints between runs. Each poller saves
+// under its own key for each destination.
+// Implement this to store checkpoints somewhere other than local disk,
+// for example DynamoDB when running more than one container.
+type CheckpointStore interface {
+	// Load returns nil if there is no checkpoint for the key
+	Load(ctx context.Context, key string) (*Checkpoint, error)
+	Save(ctx context.Context, key string, cp Checkpoint) error
+}
+
+func newCheckpointStore(cfg Config) (CheckpointStore, error) {
+	switch cfg.CheckpointStore {
+	case "file":
+		return &fileCheckpointStore{path: cfg.CheckpointPath}, nil
+	case "memory":
+		return &memoryCheckpointStore{checkpoints: map[string]Checkpoint{}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported checkpoint store: %s", cfg.CheckpointStore)
+	}
+}
+
+// fileCheckpointStore keeps every key in a single json file
+type fileCheckpointStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (f *fileCheckpointStore) read() (map[string]Checkpoint, error) {
+	checkpoints := map[string]Checkpoint{}
+
+	d, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoints, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint file: %s", err)
+	}
+
+	err = json.Unmarshal(d, &checkpoints)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse checkpoint file: %s", err)
+	}
+
+	return checkpoints, nil
+}
+
+func (f *fileCheckpointStore) Load(ctx context.Context, key string) (*Checkpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	checkpoints, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	cp, ok := checkpoints[key]
+	if !ok {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+func (f *fileCheckpointStore) Save(ctx context.Context, key string, cp Checkpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	checkpoints, err := f.read()
+	if err != nil {
+		return err
+	}
+	checkpoints[key] = cp
+
+	d, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write then rename so a crash mid-write can't leave a corrupt file
+	tmp := f.path + ".tmp"
+	err = os.WriteFile(tmp, d, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write checkpoint file: %s", err)
+	}
+
+	return os.Rename(tmp, f.path)
+}
+
+// memoryCheckpointStore doesn't survive a restart, but keeps windows
+// contiguous while running
+type memoryCheckpointStore struct {
+	checkpoints map[string]Checkpoint
+	mu          sync.Mutex
+}
+
+func (m *memoryCheckpointStore) Load(ctx context.Context, key string) (*Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp, ok := m.checkpoints[key]
+	if !ok {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+func (m *memoryCheckpointStore) Save(ctx context.Context, key string, cp Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.checkpoints[key] = cp
+	return nil
+}
@@ -9,8 +9,101 @@ import (
 
 type Config struct {
 	Debug       bool          // XOTEL_DEBUG
-	MaxLookBack time.Duration `default:"6m"` // XOTEL_MAX_LOOK_BACK
-	MinLookBack time.Duration `default:"1m"` // XOTEL_MIN_LOOK_BACK
+	MaxLookBack time.Duration `default:"6m" split_words:"true"` // XOTEL_MAX_LOOK_BACK
+	MinLookBack time.Duration `default:"1m" split_words:"true"` // XOTEL_MIN_LOOK_BACK
+	// only export traces matching this xray filter expression
+	FilterExpression string `split_words:"true"` // XOTEL_FILTER_EXPRESSION
+
+	// regions to poll, defaults to the region from the aws config
+	Regions []string // XOTEL_REGIONS
+	// names of other accounts to poll by assuming a role, each is configured
+	// with XOTEL_ACCOUNT_<NAME>_*
+	Accounts []string // XOTEL_ACCOUNTS
+	// roles in other accounts to poll without configuring each one, they're
+	// named by their account id
+	AccountRoleARNs []string `envconfig:"ACCOUNT_ROLE_ARNS"` // XOTEL_ACCOUNT_ROLE_ARNS
+	// poll the account our own credentials are for as well as XOTEL_ACCOUNTS
+	PollOwnAccount bool `default:"true" split_words:"true"` // XOTEL_POLL_OWN_ACCOUNT
+
+	// names of pipelines to run instead of the default one, each is
+	// configured with XOTEL_PIPELINE_<NAME>_*
+	Pipelines []string // XOTEL_PIPELINES
+	// names of destinations to export to as well as the default
+	// OTEL_EXPORTER_OTLP_ENDPOINT, each is configured with XOTEL_DESTINATION_<NAME>_*
+	Destinations []string // XOTEL_DESTINATIONS
+	// where pipelines send traces unless they name their own destinations
+	Destination []string `default:"default"` // XOTEL_DESTINATION
+
+	// run a pipeline for each xray group's filter expression, instead of
+	// the default pipeline
+	PollGroups bool `split_words:"true"` // XOTEL_POLL_GROUPS
+	// only poll these groups, defaults to every group with a filter expression
+	Groups                []string      // XOTEL_GROUPS
+	GroupsRefreshInterval time.Duration `default:"5m" split_words:"true"`      // XOTEL_GROUPS_REFRESH_INTERVAL
+	GroupsDestination     []string      `default:"default" split_words:"true"` // XOTEL_GROUPS_DESTINATION
+
+	// where to record the last window we exported, "file" or "memory"
+	CheckpointStore string `default:"file" split_words:"true"`                  // XOTEL_CHECKPOINT_STORE
+	CheckpointPath  string `default:"xotel-checkpoint.json" split_words:"true"` // XOTEL_CHECKPOINT_PATH
+	// the largest window we'll query at once when catching up after a restart
+	CatchUpWindow time.Duration `default:"5m" split_words:"true"` // XOTEL_CATCH_UP_WINDOW
+	// don't try to catch up on anything older than this
+	MaxCatchUp time.Duration `default:"24h" split_words:"true"` // XOTEL_MAX_CATCH_UP
+	// how many times to try a window before skipping it, 0 to never skip
+	MaxWindowAttempts int `default:"5" split_words:"true"` // XOTEL_MAX_WINDOW_ATTEMPTS
+
+	// how many trace ids to remember, and for how long, so we don't export
+	// the same trace twice. A size of 0 turns this off.
+	DedupeSize int           `default:"100000" split_words:"true"` // XOTEL_DEDUPE_SIZE
+	DedupeTTL  time.Duration `default:"10m" split_words:"true"`    // XOTEL_DEDUPE_TTL
+
+	// the most calls per second we'll make to each xray api, we slow down
+	// from here if xray throttles us. 0 means no limit.
+	GetTraceSummariesRPS float64 `default:"2" envconfig:"GET_TRACE_SUMMARIES_RPS"` // XOTEL_GET_TRACE_SUMMARIES_RPS
+	BatchGetTracesRPS    float64 `default:"5" envconfig:"BATCH_GET_TRACES_RPS"`    // XOTEL_BATCH_GET_TRACES_RPS
+
+	// partial traces are fetched again after this long, to pick up segments
+	// that arrived late. 0 turns this off.
+	ReconcileSettleDelay time.Duration `default:"2m" split_words:"true"` // XOTEL_RECONCILE_SETTLE_DELAY
+	// how long to remember which segments of a trace we've exported
+	ReconcileTTL       time.Duration `default:"15m" split_words:"true"`    // XOTEL_RECONCILE_TTL
+	ReconcileMaxTraces int           `default:"100000" split_words:"true"` // XOTEL_RECONCILE_MAX_TRACES
+
+	// span kinds to use instead of the ones worked out from the segments, as
+	// pattern:kind. The first pattern matching a segment's name, its
+	// name.operation or its origin is used, * matches anything.
+	SpanKindOverrides []string `split_words:"true"` // XOTEL_SPAN_KIND_OVERRIDES
+	// when segments with error set (a 4xx) get an ERROR status, "always",
+	// "never" or "client" for every span except servers. Faults and
+	// throttles are always ERROR.
+	ErrorStatus string `default:"client" split_words:"true"` // XOTEL_ERROR_STATUS
+
+	// how many goroutines work on each stage of the pipeline
+	FetchWorkers   int `default:"2" split_words:"true"` // XOTEL_FETCH_WORKERS
+	ConvertWorkers int `default:"2" split_words:"true"` // XOTEL_CONVERT_WORKERS
+	UploadWorkers  int `default:"4" split_words:"true"` // XOTEL_UPLOAD_WORKERS
+	// how much work can wait between each stage, polling is paused while
+	// any queue is over 80% full
+	QueueSize int `default:"1000" split_words:"true"` // XOTEL_QUEUE_SIZE
+
+	// segments are uploaded in batches of up to this many spans or bytes,
+	// or whatever has been converted after max delay
+	BatchMaxSpans int           `default:"512" split_words:"true"`     // XOTEL_BATCH_MAX_SPANS
+	BatchMaxBytes int           `default:"3000000" split_words:"true"` // XOTEL_BATCH_MAX_BYTES
+	BatchMaxDelay time.Duration `default:"1s" split_words:"true"`      // XOTEL_BATCH_MAX_DELAY
+
+	// where batches wait to be uploaded, "none" to upload them straight away
+	// or "disk" to keep them in a directory per destination until the
+	// destination accepts them
+	ExportQueue         string `default:"none" split_words:"true"`        // XOTEL_EXPORT_QUEUE
+	ExportQueuePath     string `default:"xotel-queue" split_words:"true"` // XOTEL_EXPORT_QUEUE_PATH
+	ExportQueueMaxBytes int64  `default:"1073741824" split_words:"true"`  // XOTEL_EXPORT_QUEUE_MAX_BYTES
+	// the longest we wait between tries of a queued batch
+	ExportRetryMaxInterval time.Duration `default:"1m" split_words:"true"` // XOTEL_EXPORT_RETRY_MAX_INTERVAL
+
+	// how long to wait for in flight traces to be exported when stopping,
+	// ECS waits 30s after SIGTERM before killing the task
+	ShutdownTimeout time.Duration `default:"25s" split_words:"true"` // XOTEL_SHUTDOWN_TIMEOUT
 }
 
 func getConfig() Config {
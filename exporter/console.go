@@ -0,0 +1,246 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// consoleClient prints each batch to stdout, as a tree of each trace's spans
+// or as OTLP/JSON
+type consoleClient struct {
+	format string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// consoleAttributes are shown for each span in the tree, when they're set
+var consoleAttributes = []string{
+	"http.method",
+	"http.url",
+	"http.target",
+	"http.status_code",
+	"db.system",
+	"db.name",
+	"db.statement",
+	"aws.operation",
+	"aws.namespace",
+}
+
+func newConsoleClient(dcfg DestinationConfig) (*consoleClient, error) {
+	switch dcfg.Format {
+	case "tree", "json":
+	default:
+		return nil, fmt.Errorf("unsupported console format: %s", dcfg.Format)
+	}
+
+	return &consoleClient{format: dcfg.Format, w: os.Stdout}, nil
+}
+
+func (c *consoleClient) Start(ctx context.Context) error {
+	return nil
+}
+
+func (c *consoleClient) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (c *consoleClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	var buf bytes.Buffer
+
+	if c.format == "json" {
+		d, err := marshalOTLPJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+		if err != nil {
+			return fmt.Errorf("unable to encode traces: %s", err)
+		}
+		buf.Write(d)
+		buf.WriteByte('\n')
+	} else {
+		writeTraceTrees(&buf, protoSpans)
+	}
+
+	// write each batch at once so they don't get mixed up
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.w.Write(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("unable to write to the console: %s", err)
+	}
+	return nil
+}
+
+// consoleSpan is a span in the tree, with the service it's from
+type consoleSpan struct {
+	span     *tracepb.Span
+	service  string
+	children []*consoleSpan
+}
+
+// writeTraceTrees groups the spans by trace, in the order each trace was
+// first seen, and writes each trace as a tree from its root spans. Spans
+// whose parent isn't in the batch are shown as roots.
+func writeTraceTrees(w io.Writer, rspans []*tracepb.ResourceSpans) {
+	traceIDs := []string{}
+	traces := map[string][]*consoleSpan{}
+
+	for _, rs := range rspans {
+		service := ""
+		for _, kv := range rs.Resource.GetAttributes() {
+			if kv.Key == "service.name" {
+				service = attributeString(kv.Value)
+			}
+		}
+
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				traceID := hex.EncodeToString(span.TraceId)
+				if _, ok := traces[traceID]; !ok {
+					traceIDs = append(traceIDs, traceID)
+				}
+				traces[traceID] = append(traces[traceID], &consoleSpan{span: span, service: service})
+			}
+		}
+	}
+
+	for _, traceID := range traceIDs {
+		spans := traces[traceID]
+
+		byID := map[string]*consoleSpan{}
+		for _, cs := range spans {
+			byID[string(cs.span.SpanId)] = cs
+		}
+
+		roots := []*consoleSpan{}
+		for _, cs := range spans {
+			parent, ok := byID[string(cs.span.ParentSpanId)]
+			if ok && parent != cs {
+				parent.children = append(parent.children, cs)
+			} else {
+				roots = append(roots, cs)
+			}
+		}
+
+		fmt.Fprintf(w, "trace %s\n", traceID)
+		sortConsoleSpans(roots)
+		for i, cs := range roots {
+			writeConsoleSpan(w, cs, "", i == len(roots)-1)
+		}
+	}
+}
+
+func writeConsoleSpan(w io.Writer, cs *consoleSpan, prefix string, last bool) {
+	branch, indent := "├── ", "│   "
+	if last {
+		branch, indent = "└── ", "    "
+	}
+	fmt.Fprintf(w, "%s%s%s\n", prefix, branch, consoleSpanSummary(cs))
+
+	// details line up under the span, with the line down to its children
+	childPrefix := prefix + indent
+	detailPrefix := childPrefix + "  "
+	if len(cs.children) != 0 {
+		detailPrefix = childPrefix + "│ "
+	}
+
+	attrs := map[string]*commonpb.AnyValue{}
+	for _, kv := range cs.span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	shown := []string{}
+	for _, key := range consoleAttributes {
+		if v, ok := attrs[key]; ok {
+			shown = append(shown, consoleKeyValue(key, v))
+		}
+	}
+	if len(shown) != 0 {
+		fmt.Fprintf(w, "%s%s\n", detailPrefix, strings.Join(shown, " "))
+	}
+
+	for _, evt := range cs.span.Events {
+		line := []string{"event"}
+		if evt.Name != "" {
+			line = append(line, evt.Name)
+		}
+		if evt.TimeUnixNano >= cs.span.StartTimeUnixNano {
+			line = append(line, "+"+consoleDuration(evt.TimeUnixNano-cs.span.StartTimeUnixNano))
+		}
+		for _, kv := range evt.Attributes {
+			line = append(line, consoleKeyValue(kv.Key, kv.Value))
+		}
+		fmt.Fprintf(w, "%s%s\n", detailPrefix, strings.Join(line, " "))
+	}
+
+	sortConsoleSpans(cs.children)
+	for i, child := range cs.children {
+		writeConsoleSpan(w, child, childPrefix, i == len(cs.children)-1)
+	}
+}
+
+// consoleSpanSummary is the span's name, service, kind, duration and status
+func consoleSpanSummary(cs *consoleSpan) string {
+	span := cs.span
+	parts := []string{span.Name}
+
+	if cs.service != "" {
+		parts = append(parts, "["+cs.service+"]")
+	}
+	switch span.Kind {
+	case tracepb.Span_SPAN_KIND_UNSPECIFIED, tracepb.Span_SPAN_KIND_INTERNAL:
+	default:
+		parts = append(parts, strings.ToLower(strings.TrimPrefix(span.Kind.String(), "SPAN_KIND_")))
+	}
+
+	duration := uint64(0)
+	if span.EndTimeUnixNano > span.StartTimeUnixNano {
+		duration = span.EndTimeUnixNano - span.StartTimeUnixNano
+	}
+	parts = append(parts, consoleDuration(duration))
+
+	switch span.Status.GetCode() {
+	case tracepb.Status_STATUS_CODE_ERROR:
+		status := "ERROR"
+		if span.Status.GetMessage() != "" {
+			status += ": " + span.Status.GetMessage()
+		}
+		parts = append(parts, status)
+	case tracepb.Status_STATUS_CODE_OK:
+		parts = append(parts, "OK")
+	}
+
+	return strings.Join(parts, "  ")
+}
+
+// sortConsoleSpans puts spans in the order they started
+func sortConsoleSpans(spans []*consoleSpan) {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].span.StartTimeUnixNano < spans[j].span.StartTimeUnixNano
+	})
+}
+
+func consoleDuration(ns uint64) string {
+	return time.Duration(ns).Round(time.Microsecond).String()
+}
+
+// consoleKeyValue quotes values with spaces or new lines, so each detail
+// stays on one line
+func consoleKeyValue(key string, v *commonpb.AnyValue) string {
+	s := tagValue(v)
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"") {
+		s = strconv.Quote(s)
+	}
+	return key + "=" + s
+}
@@ -0,0 +1,118 @@
+package exporter
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// seenTraces remembers which traces each poller has already sent off to
+// be exported, so overlapping windows don't fetch and upload the same trace
+// twice.
+// It holds at most size traces, dropping the least recently seen first,
+// and forgets a trace after ttl.
+type seenTraces struct {
+	// first so they're 64-bit aligned for atomic access on 32-bit platforms
+	hits   uint64
+	misses uint64
+
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently seen at the front
+}
+
+type seenTrace struct {
+	id       string
+	revision int32
+	expires  time.Time
+}
+
+func newSeenTraces(size int, ttl time.Duration) *seenTraces {
+	return &seenTraces{
+		size:    size,
+		ttl:     ttl,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// check reports whether this trace has already been seen by the poller
+// at this revision or later. If it hasn't, it's recorded as seen now.
+func (c *seenTraces) check(pollKey string, traceID string, revision int32, now time.Time) bool {
+	if c.size <= 0 {
+		return false
+	}
+	id := seenKey(pollKey, traceID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[id]; ok {
+		entry := el.Value.(*seenTrace)
+
+		if now.Before(entry.expires) && revision <= entry.revision {
+			atomic.AddUint64(&c.hits, 1)
+			return true
+		}
+
+		// a newer revision has more segments, let it through
+		entry.revision = revision
+		entry.expires = now.Add(c.ttl)
+		c.order.MoveToFront(el)
+		atomic.AddUint64(&c.misses, 1)
+		return false
+	}
+
+	c.entries[id] = c.order.PushFront(&seenTrace{
+		id:       id,
+		revision: revision,
+		expires:  now.Add(c.ttl),
+	})
+	atomic.AddUint64(&c.misses, 1)
+
+	c.evict(now)
+	return false
+}
+
+// forget drops traces so they'll be fetched again, used when a window
+// fails and is going to be retried
+func (c *seenTraces) forget(pollKey string, traceIDs []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, traceID := range traceIDs {
+		id := seenKey(pollKey, traceID)
+		if el, ok := c.entries[id]; ok {
+			c.order.Remove(el)
+			delete(c.entries, id)
+		}
+	}
+}
+
+// the same trace can be exported once by each pipeline, in each region
+func seenKey(pollKey string, traceID string) string {
+	return pollKey + "/" + traceID
+}
+
+func (c *seenTraces) evict(now time.Time) {
+	for c.order.Len() > 0 {
+		el := c.order.Back()
+		entry := el.Value.(*seenTrace)
+
+		if c.order.Len() <= c.size && now.Before(entry.expires) {
+			return
+		}
+
+		c.order.Remove(el)
+		delete(c.entries, entry.id)
+	}
+}
+
+// stats returns and resets the hit and miss counters
+func (c *seenTraces) stats() (hits uint64, misses uint64) {
+	return atomic.SwapUint64(&c.hits, 0), atomic.SwapUint64(&c.misses, 0)
+}
@@ -2,20 +2,212 @@ package exporter
 
 import (
 	"context"
-	"os"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
+	"github.com/kelseyhightower/envconfig"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/credentials"
 )
 
-// TODO: this exporter only allows connecting to a local insecure otel collector
-// Ideally you would run this on the same box/container as this app
-// If you know a better more configurable way to do this, please let me know.
-// I can't seem to get it to configure based on environment variables.
-func newExporterClient(ctx context.Context) otlptrace.Client {
+// DestinationConfig is read from XOTEL_DESTINATION_<NAME>_*, the default
+// destination reads it from XOTEL_DESTINATION_DEFAULT_*
+type DestinationConfig struct {
+	// what kind of destination this is, "otlp", "file", "zipkin", "jaeger"
+	// or "console"
+	Type string `default:"otlp"` // XOTEL_DESTINATION_<NAME>_TYPE
+	// an OTLP collector, as host:port or a url, or the url spans are POSTed
+	// to for zipkin and jaeger. Named otlp, zipkin and jaeger destinations also
+	// take the same HEADERS, CERTIFICATE, CLIENT_CERTIFICATE, CLIENT_KEY,
+	// COMPRESSION, TIMEOUT and INSECURE settings as OTEL_EXPORTER_OTLP_*
+	Endpoint string // XOTEL_DESTINATION_<NAME>_ENDPOINT
+
+	// a file to write OTLP/JSON to, rotated when it's over max bytes or
+	// older than max age
+	Path     string        // XOTEL_DESTINATION_<NAME>_PATH
+	MaxBytes int64         `default:"104857600" split_words:"true"` // XOTEL_DESTINATION_<NAME>_MAX_BYTES
+	MaxAge   time.Duration `default:"1h" split_words:"true"`        // XOTEL_DESTINATION_<NAME>_MAX_AGE
+	Gzip     bool          // XOTEL_DESTINATION_<NAME>_GZIP
+
+	// how the console prints spans, "tree" or "json"
+	Format string `default:"tree"` // XOTEL_DESTINATION_<NAME>_FORMAT
+
+	// only export spans from these services, * matches anything
+	Services []string // XOTEL_DESTINATION_<NAME>_SERVICES
+	// only export spans with these resource attributes, as key:value
+	Attributes map[string]string // XOTEL_DESTINATION_<NAME>_ATTRIBUTES
+	// only export spans polled for these xray groups
+	Groups []string // XOTEL_DESTINATION_<NAME>_GROUPS
+}
+
+// destination is somewhere we upload traces to
+type destination struct {
+	// spans uploaded since we last reported, first so it's 64-bit aligned
+	// for atomic access on 32-bit platforms
+	exported uint64
+
+	name   string
+	client otlptrace.Client
+	routes routes
+	// spans routed here waiting to be batched, each destination has its own
+	// so a slow one doesn't hold up the rest until this fills
+	spans   chan spanWork
+	batcher *batcher
+	// nil unless XOTEL_EXPORT_QUEUE is "disk"
+	queue *diskQueue
+}
+
+// newDestinations starts a client for the "default" destination, and
+// each destination named in XOTEL_DESTINATIONS
+func newDestinations(ctx context.Context, cfg Config) (map[string]*destination, error) {
+	destinations := map[string]*destination{}
+	for _, name := range append([]string{"default"}, cfg.Destinations...) {
+		if _, ok := destinations[name]; ok {
+			continue
+		}
+		prefix := fmt.Sprintf("XOTEL_DESTINATION_%s", envName(name))
+
+		var dcfg DestinationConfig
+		err := envconfig.Process(prefix, &dcfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config for destination %s: %s", name, err)
+		}
+
+		client, err := newDestinationClient(name, prefix, dcfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config for destination %s: %s", name, err)
+		}
+
+		err = client.Start(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to start destination %s: %s", name, err)
+		}
+
+		dest := &destination{
+			name:   name,
+			client: client,
+			routes: newRoutes(dcfg),
+			spans:  make(chan spanWork, cfg.QueueSize),
+		}
+		dest.batcher = newBatcher(cfg, dest.send)
+
+		switch cfg.ExportQueue {
+		case "none":
+		case "disk":
+			dest.queue, err = openDiskQueue(filepath.Join(cfg.ExportQueuePath, name), cfg.ExportQueueMaxBytes)
+			if err != nil {
+				return nil, fmt.Errorf("unable to open export queue for destination %s: %s", name, err)
+			}
+			if n := dest.queue.len(); n != 0 {
+				log.Printf("Sending (%d) batches left in the queue for %s\n", n, name)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported export queue: %s", cfg.ExportQueue)
+		}
+
+		destinations[name] = dest
+	}
+
+	return destinations, nil
+}
+
+// newDestinationClient creates the client for the destination's type. Every
+// type implements otlptrace.Client, like the otlp exporter's own clients, so
+// the rest of the pipeline doesn't need to know which it's sending to.
+func newDestinationClient(name string, prefix string, dcfg DestinationConfig) (otlptrace.Client, error) {
+	switch dcfg.Type {
+	case "otlp":
+		// the default destination is configured like any other otel exporter
+		if name == "default" {
+			prefix = "OTEL_EXPORTER_OTLP"
+		} else if dcfg.Endpoint == "" {
+			return nil, fmt.Errorf("%s_ENDPOINT is required", prefix)
+		}
+
+		ocfg, err := getOTLPConfig(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return newExporterClient(ocfg), nil
+
+	case "file":
+		return newFileClient(dcfg)
+
+	case "zipkin":
+		// headers, tls and timeouts are set the same way as for otlp
+		ocfg, err := getOTLPConfig(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return newZipkinClient(dcfg.Endpoint, ocfg)
+
+	case "jaeger":
+		ocfg, err := getOTLPConfig(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return newJaegerClient(dcfg.Endpoint, ocfg)
+
+	case "console":
+		return newConsoleClient(dcfg)
+
+	default:
+		return nil, fmt.Errorf("unsupported destination type: %s", dcfg.Type)
+	}
+}
+
+// send takes a full batch, and puts it in the queue if there is one
+func (d *destination) send(ctx context.Context, rspans []*tracepb.ResourceSpans) error {
+	if d.queue != nil {
+		return d.queue.push(ctx, rspans)
+	}
+	return d.upload(ctx, rspans)
+}
+
+func (d *destination) upload(ctx context.Context, rspans []*tracepb.ResourceSpans) error {
+	err := d.client.UploadTraces(ctx, rspans)
+	if err != nil {
+		return fmt.Errorf("unable to upload to %s: %s", d.name, err)
+	}
+
+	spans := 0
+	for _, rs := range rspans {
+		spans += countSpans(rs)
+	}
+	atomic.AddUint64(&d.exported, uint64(spans))
+
+	return nil
+}
+
+func newExporterClient(ocfg otlpConfig) otlptrace.Client {
+	if ocfg.protocol != "grpc" {
+		return newHTTPClient(ocfg)
+	}
+	return newGRPCClient(ocfg)
+}
+
+// newGRPCClient sets each option explicitly, otherwise the otlp library
+// would also apply OTEL_EXPORTER_OTLP_* to named destinations
+func newGRPCClient(ocfg otlpConfig) otlptrace.Client {
 	opts := []otlptracegrpc.Option{
-		otlptracegrpc.WithEndpoint(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
-		otlptracegrpc.WithInsecure(),
+		otlptracegrpc.WithEndpoint(ocfg.endpoint),
+		otlptracegrpc.WithHeaders(ocfg.headers),
+		otlptracegrpc.WithTimeout(ocfg.timeout),
+	}
+
+	if ocfg.compression == "gzip" {
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	}
+
+	if ocfg.insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(ocfg.tls)))
 	}
 
 	return otlptracegrpc.NewClient(opts...)
@@ -0,0 +1,202 @@
+package exporter
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// fileClient writes each batch as a line of OTLP/JSON, starting a new file
+// when the current one gets too big or too old
+type fileClient struct {
+	path     string
+	maxBytes int64
+	maxAge   time.Duration
+	gzip     bool
+
+	mu     sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	w      io.Writer
+	size   int64
+	opened time.Time
+}
+
+func newFileClient(dcfg DestinationConfig) (*fileClient, error) {
+	if dcfg.Path == "" {
+		return nil, fmt.Errorf("a path is required for a file destination")
+	}
+
+	return &fileClient{
+		path:     dcfg.Path,
+		maxBytes: dcfg.MaxBytes,
+		maxAge:   dcfg.MaxAge,
+		gzip:     dcfg.Gzip,
+	}, nil
+}
+
+func (c *fileClient) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.open()
+}
+
+func (c *fileClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.close()
+}
+
+func (c *fileClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	d, err := marshalOTLPJSON(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return fmt.Errorf("unable to encode traces: %s", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the last rotate couldn't open a new file
+	if c.file == nil {
+		err = c.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.shouldRotate(time.Now()) {
+		err = c.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.w.Write(append(d, '\n'))
+	if err == nil && c.gz != nil {
+		// so every line that's been exported can be read back
+		err = c.gz.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write to %s: %s", c.path, err)
+	}
+
+	return nil
+}
+
+func (c *fileClient) shouldRotate(now time.Time) bool {
+	if c.size == 0 {
+		return false
+	}
+	if c.maxBytes > 0 && c.size >= c.maxBytes {
+		return true
+	}
+	return c.maxAge > 0 && now.Sub(c.opened) >= c.maxAge
+}
+
+// open appends to the file at path, a restart picks up where it left off
+func (c *fileClient) open() error {
+	err := os.MkdirAll(filepath.Dir(c.path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create directory for %s: %s", c.path, err)
+	}
+
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %s", c.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("unable to open %s: %s", c.path, err)
+	}
+
+	c.file = f
+	c.size = info.Size()
+	c.opened = time.Now()
+	c.w = &countingWriter{w: f, n: &c.size}
+	c.gz = nil
+	if c.gzip {
+		// gzip streams can be appended to each other, so this is still a
+		// valid file after a restart
+		c.gz = gzip.NewWriter(c.w)
+		c.w = c.gz
+	}
+
+	return nil
+}
+
+func (c *fileClient) close() error {
+	if c.file == nil {
+		return nil
+	}
+
+	var err error
+	if c.gz != nil {
+		err = c.gz.Close()
+	}
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	c.file = nil
+
+	if err != nil {
+		return fmt.Errorf("unable to close %s: %s", c.path, err)
+	}
+	return nil
+}
+
+// rotate moves the current file aside with the time it was started, eg
+// traces.jsonl becomes traces-20220701T090000Z.jsonl, then opens a new one
+func (c *fileClient) rotate() error {
+	err := c.close()
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(c.path)
+	base := strings.TrimSuffix(c.path, ext)
+	if ext == ".gz" {
+		ext = filepath.Ext(base) + ext
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	stamp := c.opened.UTC().Format("20060102T150405Z")
+	rotated := fmt.Sprintf("%s-%s%s", base, stamp, ext)
+	for i := 1; fileExists(rotated); i++ {
+		rotated = fmt.Sprintf("%s-%s-%d%s", base, stamp, i, ext)
+	}
+
+	err = os.Rename(c.path, rotated)
+	if err != nil {
+		return fmt.Errorf("unable to rotate %s: %s", c.path, err)
+	}
+
+	return c.open()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// countingWriter keeps track of how much has been written to the file
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
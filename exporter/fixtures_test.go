@@ -0,0 +1,88 @@
+package exporter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// the trace the destination tests upload, checkout calling orders
+var (
+	testStart        = uint64(time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC).UnixNano())
+	testTraceID      = []byte{0x62, 0x6e, 0x9c, 0x1a, 0x4a, 0x5e, 0x2b, 0x1f, 0x9c, 0x3d, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	testClientSpanID = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	testServerSpanID = []byte{0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11}
+)
+
+func testKV(key string, v attribute.Value) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: Value(v)}
+}
+
+// testResourceSpans is a checkout server span, and its client span calling
+// orders with attrs that timed out
+func testResourceSpans(attrs ...*commonpb.KeyValue) []*tracepb.ResourceSpans {
+	return []*tracepb.ResourceSpans{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			testKV("service.name", attribute.StringValue("checkout")),
+			testKV("cloud.region", attribute.StringValue("ap-southeast-2")),
+		}},
+		ScopeSpans: []*tracepb.ScopeSpans{{
+			Scope: &commonpb.InstrumentationScope{Name: "X-Ray for Go", Version: "1.7.0"},
+			Spans: []*tracepb.Span{
+				{
+					TraceId:           testTraceID,
+					SpanId:            testClientSpanID,
+					ParentSpanId:      testServerSpanID,
+					Name:              "orders",
+					Kind:              tracepb.Span_SPAN_KIND_CLIENT,
+					StartTimeUnixNano: testStart,
+					EndTimeUnixNano:   testStart + uint64(25*time.Millisecond),
+					Attributes:        attrs,
+					Events: []*tracepb.Span_Event{{
+						Name:         "exception",
+						TimeUnixNano: testStart + uint64(20*time.Millisecond),
+						Attributes: []*commonpb.KeyValue{
+							testKV("exception.type", attribute.StringValue("TimeoutError")),
+						},
+					}},
+					Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "timed out"},
+				},
+				{
+					TraceId:           testTraceID,
+					SpanId:            testServerSpanID,
+					Name:              "checkout",
+					Kind:              tracepb.Span_SPAN_KIND_SERVER,
+					StartTimeUnixNano: testStart,
+					EndTimeUnixNano:   testStart + uint64(30*time.Millisecond),
+					Status:            &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK},
+				},
+			},
+		}},
+	}}
+}
+
+// capturedRequest is the last request a capture server got
+type capturedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newCaptureServer accepts every request, keeping the last one
+func newCaptureServer(t *testing.T) (*httptest.Server, *capturedRequest) {
+	got := &capturedRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.header = r.Header.Clone()
+		got.body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, got
+}
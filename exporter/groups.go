@@ -0,0 +1,166 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/xray"
+	"github.com/aws/aws-sdk-go-v2/service/xray/types"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// groupPoller is the poller running for a group, stopped when the group
+// is deleted or its filter expression changes
+type groupPoller struct {
+	filterExpression string
+	cancel           context.CancelFunc
+	done             chan struct{}
+}
+
+// watchGroups keeps a poller running for each xray group in the source,
+// checking for new, changed or deleted groups every
+// XOTEL_GROUPS_REFRESH_INTERVAL
+func (svc *Service) watchGroups(ctx context.Context, workCtx context.Context, src *source) {
+	ticker := time.NewTicker(svc.cfg.GroupsRefreshInterval)
+	defer ticker.Stop()
+
+	running := map[string]*groupPoller{}
+
+	for {
+		err := svc.refreshGroups(ctx, workCtx, src, running)
+		if err != nil {
+			svc.errors <- fmt.Errorf("unable to refresh xray groups in %s: %s", src.region, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (svc *Service) refreshGroups(ctx context.Context, workCtx context.Context, src *source, running map[string]*groupPoller) error {
+	pipelines, err := svc.groupPipelines(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	found := map[string]bool{}
+	for _, pl := range pipelines {
+		found[pl.name] = true
+
+		if gp, ok := running[pl.name]; ok {
+			if gp.filterExpression == *pl.filterExpression {
+				continue
+			}
+
+			log.Printf("Filter expression changed for %s\n", pl.name)
+			gp.cancel()
+			<-gp.done
+		}
+
+		p, err := svc.newPoller(ctx, src, pl)
+		if err != nil {
+			return fmt.Errorf("unable to load checkpoint: %s", err)
+		}
+
+		pollCtx, cancel := context.WithCancel(ctx)
+		gp := &groupPoller{
+			filterExpression: *pl.filterExpression,
+			cancel:           cancel,
+			done:             make(chan struct{}),
+		}
+		running[pl.name] = gp
+
+		log.Printf("Polling %s\n", p.key)
+		svc.startProducer(func() {
+			p.run(pollCtx, workCtx)
+			close(gp.done)
+		})
+	}
+
+	for name, gp := range running {
+		if !found[name] {
+			log.Printf("Stopped polling %s, the group is gone\n", name)
+			gp.cancel()
+			delete(running, name)
+		}
+	}
+
+	return nil
+}
+
+// groupPipelines returns a pipeline for each group in the source we
+// should poll
+func (svc *Service) groupPipelines(ctx context.Context, src *source) ([]*pipeline, error) {
+	groups, err := svc.listGroups(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	dests, err := lookupDestinations(svc.cfg.GroupsDestination, svc.destinations)
+	if err != nil {
+		return nil, fmt.Errorf("groups %s", err)
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range svc.cfg.Groups {
+		wanted[name] = true
+	}
+
+	pipelines := []*pipeline{}
+	for _, g := range groups {
+		if g.GroupName == nil || g.GroupARN == nil {
+			continue
+		}
+
+		if len(wanted) != 0 && !wanted[*g.GroupName] {
+			continue
+		}
+
+		// the Default group has no filter and matches every trace, so only
+		// poll it when it's asked for by name
+		filterExpression := ""
+		if g.FilterExpression != nil {
+			filterExpression = *g.FilterExpression
+		}
+		if filterExpression == "" && !wanted[*g.GroupName] {
+			continue
+		}
+
+		pipelines = append(pipelines, &pipeline{
+			name:             fmt.Sprintf("group-%s", *g.GroupName),
+			filterExpression: &filterExpression,
+			destinations:     dests,
+			maxLookBack:      svc.cfg.MaxLookBack * -1,
+			minLookBack:      svc.cfg.MinLookBack * -1,
+			resourceAttrs: KeyValues([]attribute.KeyValue{
+				attribute.String("aws.xray.group.name", *g.GroupName),
+				attribute.String("aws.xray.group.arn", *g.GroupARN),
+			}),
+		})
+	}
+
+	return pipelines, nil
+}
+
+func (svc *Service) listGroups(ctx context.Context, src *source) ([]types.GroupSummary, error) {
+	groups := []types.GroupSummary{}
+
+	var nextToken *string
+	for {
+		output, err := src.xry.GetGroups(ctx, &xray.GetGroupsInput{NextToken: nextToken})
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, output.Groups...)
+
+		if output.NextToken == nil {
+			return groups, nil
+		}
+		nextToken = output.NextToken
+	}
+}
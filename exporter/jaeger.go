@@ -0,0 +1,358 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// jaegerClient POSTs spans to a Jaeger collector's /api/traces as Thrift
+type jaegerClient struct {
+	*httpClient
+}
+
+func newJaegerClient(endpoint string, ocfg otlpConfig) (*jaegerClient, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("a jaeger endpoint must be a url, like http://localhost:14268/api/traces")
+	}
+
+	ocfg.url = endpoint
+	return &jaegerClient{httpClient: newHTTPClient(ocfg)}, nil
+}
+
+// UploadTraces sends a batch for each resource, as jaeger only takes one
+// process per request
+func (c *jaegerClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	for _, rs := range mergeResourceSpans(protoSpans) {
+		var t thriftWriter
+		writeJaegerBatch(&t, rs)
+
+		err := c.send(ctx, "application/x-thrift", t.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// the parts of jaeger.thrift we use, from
+// https://github.com/jaegertracing/jaeger-idl/blob/main/thrift/jaeger.thrift
+const (
+	jaegerTagString = 0
+	jaegerTagDouble = 1
+	jaegerTagBool   = 2
+	jaegerTagLong   = 3
+	jaegerTagBinary = 4
+
+	jaegerChildOf = 0
+	jaegerSampled = 1
+)
+
+var jaegerKinds = map[tracepb.Span_SpanKind]string{
+	tracepb.Span_SPAN_KIND_SERVER:   "server",
+	tracepb.Span_SPAN_KIND_CLIENT:   "client",
+	tracepb.Span_SPAN_KIND_PRODUCER: "producer",
+	tracepb.Span_SPAN_KIND_CONSUMER: "consumer",
+}
+
+// jaegerTag is a key and one of the values, set by vType
+type jaegerTag struct {
+	key     string
+	vType   int32
+	vStr    string
+	vDouble float64
+	vBool   bool
+	vLong   int64
+	vBinary []byte
+}
+
+func toJaegerTag(kv *commonpb.KeyValue) jaegerTag {
+	tag := jaegerTag{key: kv.Key}
+
+	switch v := kv.Value.GetValue().(type) {
+	case *commonpb.AnyValue_BoolValue:
+		tag.vType, tag.vBool = jaegerTagBool, v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		tag.vType, tag.vLong = jaegerTagLong, v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		tag.vType, tag.vDouble = jaegerTagDouble, v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		tag.vType, tag.vBinary = jaegerTagBinary, v.BytesValue
+	default:
+		tag.vType, tag.vStr = jaegerTagString, tagValue(kv.Value)
+	}
+
+	return tag
+}
+
+func jaegerStringTag(key string, value string) jaegerTag {
+	return jaegerTag{key: key, vType: jaegerTagString, vStr: value}
+}
+
+// writeJaegerBatch writes a Batch, with the resource as the Process
+func writeJaegerBatch(t *thriftWriter, rs *tracepb.ResourceSpans) {
+	serviceName := "unknown"
+	processTags := []jaegerTag{}
+	for _, kv := range rs.Resource.GetAttributes() {
+		if kv.Key == "service.name" {
+			serviceName = attributeString(kv.Value)
+			continue
+		}
+		processTags = append(processTags, toJaegerTag(kv))
+	}
+
+	// 1: required Process process
+	t.fieldBegin(thriftStruct, 1)
+	t.fieldBegin(thriftString, 1)
+	t.string(serviceName)
+	t.fieldBegin(thriftList, 2)
+	writeJaegerTags(t, processTags)
+	t.fieldStop()
+
+	spans := []*tracepb.Span{}
+	scopeTags := [][]jaegerTag{}
+	for _, ss := range rs.ScopeSpans {
+		tags := []jaegerTag{}
+		if ss.Scope.GetName() != "" {
+			tags = append(tags, jaegerStringTag("otel.library.name", ss.Scope.GetName()))
+		}
+		if ss.Scope.GetVersion() != "" {
+			tags = append(tags, jaegerStringTag("otel.library.version", ss.Scope.GetVersion()))
+		}
+
+		for _, span := range ss.Spans {
+			spans = append(spans, span)
+			scopeTags = append(scopeTags, tags)
+		}
+	}
+
+	// 2: required list<Span> spans
+	t.fieldBegin(thriftList, 2)
+	t.listBegin(thriftStruct, len(spans))
+	for i, span := range spans {
+		writeJaegerSpan(t, span, scopeTags[i])
+	}
+
+	t.fieldStop()
+}
+
+func writeJaegerSpan(t *thriftWriter, span *tracepb.Span, extraTags []jaegerTag) {
+	traceHigh, traceLow := jaegerTraceID(span.TraceId)
+	parentID := jaegerID(span.ParentSpanId)
+
+	t.fieldBegin(thriftI64, 1)
+	t.i64(traceLow)
+	t.fieldBegin(thriftI64, 2)
+	t.i64(traceHigh)
+	t.fieldBegin(thriftI64, 3)
+	t.i64(jaegerID(span.SpanId))
+	t.fieldBegin(thriftI64, 4)
+	t.i64(parentID)
+	t.fieldBegin(thriftString, 5)
+	t.string(span.Name)
+
+	// 6: optional list<SpanRef> references
+	if parentID != 0 {
+		t.fieldBegin(thriftList, 6)
+		t.listBegin(thriftStruct, 1)
+		t.fieldBegin(thriftI32, 1)
+		t.i32(jaegerChildOf)
+		t.fieldBegin(thriftI64, 2)
+		t.i64(traceLow)
+		t.fieldBegin(thriftI64, 3)
+		t.i64(traceHigh)
+		t.fieldBegin(thriftI64, 4)
+		t.i64(parentID)
+		t.fieldStop()
+	}
+
+	t.fieldBegin(thriftI32, 7)
+	t.i32(jaegerSampled)
+	t.fieldBegin(thriftI64, 8)
+	t.i64(int64(span.StartTimeUnixNano / 1000))
+	t.fieldBegin(thriftI64, 9)
+	duration := int64(0)
+	if span.EndTimeUnixNano > span.StartTimeUnixNano {
+		duration = int64((span.EndTimeUnixNano - span.StartTimeUnixNano) / 1000)
+	}
+	t.i64(duration)
+
+	tags := append([]jaegerTag{}, extraTags...)
+	hasErrorTag := false
+	for _, kv := range span.Attributes {
+		tags = append(tags, toJaegerTag(kv))
+		hasErrorTag = hasErrorTag || kv.Key == "error"
+	}
+	if kind, ok := jaegerKinds[span.Kind]; ok {
+		tags = append(tags, jaegerStringTag("span.kind", kind))
+	}
+	switch span.Status.GetCode() {
+	case tracepb.Status_STATUS_CODE_ERROR:
+		tags = append(tags, jaegerStringTag("otel.status_code", "ERROR"))
+		// jaeger shows spans with error=true as failed
+		if !hasErrorTag {
+			tags = append(tags, jaegerTag{key: "error", vType: jaegerTagBool, vBool: true})
+		}
+		if span.Status.GetMessage() != "" {
+			tags = append(tags, jaegerStringTag("otel.status_description", span.Status.GetMessage()))
+		}
+	case tracepb.Status_STATUS_CODE_OK:
+		tags = append(tags, jaegerStringTag("otel.status_code", "OK"))
+	}
+
+	// 10: optional list<Tag> tags
+	t.fieldBegin(thriftList, 10)
+	writeJaegerTags(t, tags)
+
+	// 11: optional list<Log> logs
+	if len(span.Events) != 0 {
+		t.fieldBegin(thriftList, 11)
+		t.listBegin(thriftStruct, len(span.Events))
+		for _, evt := range span.Events {
+			ts := evt.TimeUnixNano
+			if ts == 0 {
+				ts = span.StartTimeUnixNano
+			}
+
+			fields := []jaegerTag{}
+			if evt.Name != "" {
+				fields = append(fields, jaegerStringTag("event", evt.Name))
+			}
+			for _, kv := range evt.Attributes {
+				fields = append(fields, toJaegerTag(kv))
+			}
+
+			t.fieldBegin(thriftI64, 1)
+			t.i64(int64(ts / 1000))
+			t.fieldBegin(thriftList, 2)
+			writeJaegerTags(t, fields)
+			t.fieldStop()
+		}
+	}
+
+	t.fieldStop()
+}
+
+func writeJaegerTags(t *thriftWriter, tags []jaegerTag) {
+	t.listBegin(thriftStruct, len(tags))
+	for _, tag := range tags {
+		t.fieldBegin(thriftString, 1)
+		t.string(tag.key)
+		t.fieldBegin(thriftI32, 2)
+		t.i32(tag.vType)
+
+		switch tag.vType {
+		case jaegerTagString:
+			t.fieldBegin(thriftString, 3)
+			t.string(tag.vStr)
+		case jaegerTagDouble:
+			t.fieldBegin(thriftDouble, 4)
+			t.double(tag.vDouble)
+		case jaegerTagBool:
+			t.fieldBegin(thriftBool, 5)
+			t.bool(tag.vBool)
+		case jaegerTagLong:
+			t.fieldBegin(thriftI64, 6)
+			t.i64(tag.vLong)
+		case jaegerTagBinary:
+			t.fieldBegin(thriftString, 7)
+			t.binary(tag.vBinary)
+		}
+
+		t.fieldStop()
+	}
+}
+
+// jaegerTraceID splits a 16 byte trace id into its high and low halves
+func jaegerTraceID(id []byte) (int64, int64) {
+	if len(id) != 16 {
+		return 0, 0
+	}
+	return int64(binary.BigEndian.Uint64(id[:8])), int64(binary.BigEndian.Uint64(id[8:]))
+}
+
+func jaegerID(id []byte) int64 {
+	if len(id) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(id))
+}
+
+// thrift binary protocol field types
+const (
+	thriftBool   = 2
+	thriftDouble = 4
+	thriftI32    = 8
+	thriftI64    = 10
+	thriftString = 11
+	thriftStruct = 12
+	thriftList   = 15
+)
+
+// thriftWriter writes the thrift binary protocol, just enough of it for
+// jaeger. Structs are written as their fields followed by fieldStop.
+type thriftWriter struct {
+	bytes.Buffer
+}
+
+func (t *thriftWriter) fieldBegin(typ byte, id int16) {
+	t.WriteByte(typ)
+	t.i16(id)
+}
+
+func (t *thriftWriter) fieldStop() {
+	t.WriteByte(0)
+}
+
+func (t *thriftWriter) listBegin(elemType byte, size int) {
+	t.WriteByte(elemType)
+	t.i32(int32(size))
+}
+
+func (t *thriftWriter) bool(v bool) {
+	if v {
+		t.WriteByte(1)
+	} else {
+		t.WriteByte(0)
+	}
+}
+
+func (t *thriftWriter) i16(v int16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	t.Write(b[:])
+}
+
+func (t *thriftWriter) i32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	t.Write(b[:])
+}
+
+func (t *thriftWriter) i64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	t.Write(b[:])
+}
+
+func (t *thriftWriter) double(v float64) {
+	t.i64(int64(math.Float64bits(v)))
+}
+
+func (t *thriftWriter) string(v string) {
+	t.i32(int32(len(v)))
+	t.WriteString(v)
+}
+
+func (t *thriftWriter) binary(v []byte) {
+	t.i32(int32(len(v)))
+	t.Write(v)
+}
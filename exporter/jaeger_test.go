@@ -0,0 +1,206 @@
+package exporter
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// thriftReader reads the thrift binary protocol back, structs as their
+// fields by id and lists as slices, so the test doesn't trust the writer
+type thriftReader struct {
+	b   []byte
+	err error
+}
+
+func (r *thriftReader) next(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	if len(r.b) < n {
+		r.err = fmt.Errorf("want %d bytes, have %d", n, len(r.b))
+		return make([]byte, n)
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftBool:
+		return r.next(1)[0] == 1
+	case thriftDouble:
+		return math.Float64frombits(binary.BigEndian.Uint64(r.next(8)))
+	case thriftI32:
+		return int32(binary.BigEndian.Uint32(r.next(4)))
+	case thriftI64:
+		return int64(binary.BigEndian.Uint64(r.next(8)))
+	case thriftString:
+		n := int32(binary.BigEndian.Uint32(r.next(4)))
+		return string(r.next(int(n)))
+	case thriftStruct:
+		return r.structure()
+	case thriftList:
+		elemType := r.next(1)[0]
+		n := int32(binary.BigEndian.Uint32(r.next(4)))
+		list := []interface{}{}
+		for i := int32(0); i < n && r.err == nil; i++ {
+			list = append(list, r.value(elemType))
+		}
+		return list
+	}
+	r.err = fmt.Errorf("unexpected thrift type %d", typ)
+	return nil
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	for r.err == nil {
+		typ := r.next(1)[0]
+		if typ == 0 {
+			break
+		}
+		id := int16(binary.BigEndian.Uint16(r.next(2)))
+		fields[id] = r.value(typ)
+	}
+	return fields
+}
+
+// jaegerTestTags reads a list<Tag> as key to value
+func jaegerTestTags(t *testing.T, v interface{}) map[string]interface{} {
+	tags := map[string]interface{}{}
+	for _, tv := range v.([]interface{}) {
+		tag := tv.(map[int16]interface{})
+		key := tag[1].(string)
+
+		// the value is in the field for its type, 3 to 7
+		vType := tag[2].(int32)
+		if len(tag) != 3 {
+			t.Errorf("tag %s has fields %v, want key, type and one value", key, tag)
+		}
+		tags[key] = tag[int16(vType)+3]
+	}
+	return tags
+}
+
+func TestJaegerUploadTraces(t *testing.T) {
+	srv, got := newCaptureServer(t)
+
+	c, err := newJaegerClient(srv.URL+"/api/traces", otlpConfig{timeout: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rspans := testResourceSpans(
+		testKV("http.method", attribute.StringValue("POST")),
+		testKV("http.status_code", attribute.Int64Value(504)),
+		testKV("aws.xray.fault", attribute.BoolValue(true)),
+		testKV("sampled.ratio", attribute.Float64Value(0.5)),
+	)
+
+	err = c.UploadTraces(context.Background(), rspans)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType := got.header.Get("Content-Type"); contentType != "application/x-thrift" {
+		t.Errorf("content type = %q", contentType)
+	}
+
+	r := &thriftReader{b: got.body}
+	batch := r.structure()
+	if r.err != nil {
+		t.Fatalf("unable to read batch: %s", r.err)
+	}
+	if len(r.b) != 0 {
+		t.Fatalf("(%d) bytes left after the batch", len(r.b))
+	}
+
+	// Process
+	process := batch[1].(map[int16]interface{})
+	if process[1] != "checkout" {
+		t.Errorf("process service name = %v", process[1])
+	}
+	if got, want := jaegerTestTags(t, process[2]), map[string]interface{}{"cloud.region": "ap-southeast-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("process tags = %v, want %v", got, want)
+	}
+
+	spans := batch[2].([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("got (%d) spans, want 2", len(spans))
+	}
+
+	// Span, with its SpanRef, Tags and Log
+	span := spans[0].(map[int16]interface{})
+	traceHigh, traceLow := int64(0x626e9c1a4a5e2b1f), int64(-0x63c2eeddccbbaa9a) // 0x9c3d112233445566
+	parentID := int64(0x0a0b0c0d0e0f1011)
+	wantFields := map[int16]interface{}{
+		1: traceLow,
+		2: traceHigh,
+		3: int64(0x0102030405060708),
+		4: parentID,
+		5: "orders",
+		7: int32(1),
+		8: int64(1651399200000000),
+		9: int64(25000),
+	}
+	for id, want := range wantFields {
+		if span[id] != want {
+			t.Errorf("span field %d = %v, want %v", id, span[id], want)
+		}
+	}
+
+	refs := span[6].([]interface{})
+	wantRef := map[int16]interface{}{1: int32(jaegerChildOf), 2: traceLow, 3: traceHigh, 4: parentID}
+	if len(refs) != 1 || !reflect.DeepEqual(refs[0], wantRef) {
+		t.Errorf("span references = %v, want [%v]", refs, wantRef)
+	}
+
+	wantTags := map[string]interface{}{
+		"otel.library.name":       "X-Ray for Go",
+		"otel.library.version":    "1.7.0",
+		"http.method":             "POST",
+		"http.status_code":        int64(504),
+		"aws.xray.fault":          true,
+		"sampled.ratio":           0.5,
+		"span.kind":               "client",
+		"otel.status_code":        "ERROR",
+		"error":                   true,
+		"otel.status_description": "timed out",
+	}
+	if got := jaegerTestTags(t, span[10]); !reflect.DeepEqual(got, wantTags) {
+		t.Errorf("span tags = %v, want %v", got, wantTags)
+	}
+
+	logs := span[11].([]interface{})
+	if len(logs) != 1 {
+		t.Fatalf("got (%d) logs, want 1", len(logs))
+	}
+	entry := logs[0].(map[int16]interface{})
+	if entry[1] != int64(1651399200020000) {
+		t.Errorf("log timestamp = %v", entry[1])
+	}
+	wantLogFields := map[string]interface{}{"event": "exception", "exception.type": "TimeoutError"}
+	if got := jaegerTestTags(t, entry[2]); !reflect.DeepEqual(got, wantLogFields) {
+		t.Errorf("log fields = %v, want %v", got, wantLogFields)
+	}
+
+	// a root span has no parent or references
+	root := spans[1].(map[int16]interface{})
+	if root[4] != int64(0) {
+		t.Errorf("root span parent = %v", root[4])
+	}
+	if _, ok := root[6]; ok {
+		t.Errorf("root span has references %v", root[6])
+	}
+	if _, ok := root[11]; ok {
+		t.Errorf("root span has logs %v", root[11])
+	}
+}
@@ -0,0 +1,210 @@
+package exporter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpConfig is how to reach an OTLP collector, read from the standard
+// OTEL_EXPORTER_OTLP_* variables for the default destination, and from
+// XOTEL_DESTINATION_<NAME>_* for the others
+type otlpConfig struct {
+	// "grpc", "http/protobuf" or "http/json"
+	protocol string
+	// host:port
+	endpoint string
+	// where to POST traces to, for the http protocols
+	url         string
+	insecure    bool
+	tls         *tls.Config
+	headers     map[string]string
+	compression string
+	timeout     time.Duration
+}
+
+// otlpEnv looks up settings under a prefix, preferring the traces specific
+// variable, eg OTEL_EXPORTER_OTLP_TRACES_ENDPOINT over OTEL_EXPORTER_OTLP_ENDPOINT
+type otlpEnv string
+
+func (prefix otlpEnv) get(name string) string {
+	v, _ := prefix.lookup(name)
+	return v
+}
+
+// lookup also says whether the value came from the traces specific variable
+func (prefix otlpEnv) lookup(name string) (string, bool) {
+	if v, ok := os.LookupEnv(fmt.Sprintf("%s_TRACES_%s", prefix, name)); ok {
+		return v, true
+	}
+	return os.Getenv(fmt.Sprintf("%s_%s", prefix, name)), false
+}
+
+func getOTLPConfig(prefix string) (otlpConfig, error) {
+	env := otlpEnv(prefix)
+	ocfg := otlpConfig{
+		protocol:    "grpc",
+		endpoint:    "localhost:4317",
+		compression: "none",
+		timeout:     10 * time.Second,
+	}
+
+	switch p := env.get("PROTOCOL"); p {
+	case "", "grpc":
+	case "http/protobuf", "http/json":
+		ocfg.protocol = p
+		ocfg.endpoint = "localhost:4318"
+	default:
+		return ocfg, fmt.Errorf("unsupported %s_PROTOCOL: %s", prefix, p)
+	}
+
+	// a bare host:port uses tls unless INSECURE is true, as the spec says,
+	// the default endpoint is a local collector without tls
+	insecure := false
+	if v := env.get("INSECURE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return ocfg, fmt.Errorf("unable to parse %s_INSECURE: %s", prefix, err)
+		}
+		insecure = b
+	}
+
+	// the traces endpoint is the full url, otherwise /v1/traces is added
+	// to the path when exporting over http
+	path := ""
+	endpoint, tracesEndpoint := env.lookup("ENDPOINT")
+	if endpoint == "" && env.get("INSECURE") == "" {
+		insecure = true
+	}
+	if endpoint != "" {
+		ocfg.endpoint = endpoint
+
+		if strings.Contains(endpoint, "://") {
+			u, err := url.Parse(endpoint)
+			if err != nil {
+				return ocfg, fmt.Errorf("unable to parse %s_ENDPOINT: %s", prefix, err)
+			}
+
+			switch u.Scheme {
+			case "http":
+				insecure = true
+			case "https":
+				insecure = false
+			default:
+				return ocfg, fmt.Errorf("unsupported scheme in %s_ENDPOINT: %s", prefix, u.Scheme)
+			}
+
+			ocfg.endpoint = u.Host
+			path = u.Path
+		}
+	}
+	ocfg.insecure = insecure
+
+	if !tracesEndpoint {
+		path = strings.TrimSuffix(path, "/") + "/v1/traces"
+	}
+	scheme := "https"
+	if ocfg.insecure {
+		scheme = "http"
+	}
+	ocfg.url = fmt.Sprintf("%s://%s%s", scheme, ocfg.endpoint, path)
+
+	headers, err := parseOTLPHeaders(env.get("HEADERS"))
+	if err != nil {
+		return ocfg, fmt.Errorf("unable to parse %s_HEADERS: %s", prefix, err)
+	}
+	ocfg.headers = headers
+
+	switch c := env.get("COMPRESSION"); c {
+	case "", "none":
+	case "gzip":
+		ocfg.compression = c
+	default:
+		return ocfg, fmt.Errorf("unsupported %s_COMPRESSION: %s", prefix, c)
+	}
+
+	if v := env.get("TIMEOUT"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return ocfg, fmt.Errorf("unable to parse %s_TIMEOUT: %s", prefix, err)
+		}
+		ocfg.timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	if !ocfg.insecure {
+		ocfg.tls, err = otlpTLSConfig(env)
+		if err != nil {
+			return ocfg, err
+		}
+	}
+
+	return ocfg, nil
+}
+
+// parseOTLPHeaders reads a list of key=value pairs, with url encoded values
+func parseOTLPHeaders(s string) (map[string]string, error) {
+	headers := map[string]string{}
+
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+
+		key, err := url.QueryUnescape(strings.TrimSpace(kv[0]))
+		if err != nil {
+			return nil, err
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, err
+		}
+
+		headers[key] = value
+	}
+
+	return headers, nil
+}
+
+// otlpTLSConfig trusts CERTIFICATE as well as the system roots, and
+// presents CLIENT_CERTIFICATE when the collector wants mTLS
+func otlpTLSConfig(env otlpEnv) (*tls.Config, error) {
+	tlsCfg := &tls.Config{}
+
+	if path := env.get("CERTIFICATE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s_CERTIFICATE: %s", env, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", path)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	certPath := env.get("CLIENT_CERTIFICATE")
+	keyPath := env.get("CLIENT_KEY")
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load %s_CLIENT_CERTIFICATE: %s", env, err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
@@ -0,0 +1,188 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// give up retrying an upload after this long
+const maxHTTPRetryTime = time.Minute
+
+// httpClient uploads traces to an OTLP/HTTP collector. Other http based
+// destinations embed it for its retries.
+type httpClient struct {
+	ocfg   otlpConfig
+	client *http.Client
+}
+
+func newHTTPClient(ocfg otlpConfig) *httpClient {
+	return &httpClient{
+		ocfg: ocfg,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: ocfg.tls,
+			},
+		},
+	}
+}
+
+func (c *httpClient) Start(ctx context.Context) error {
+	return nil
+}
+
+func (c *httpClient) Stop(ctx context.Context) error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *httpClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	req := &coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans}
+
+	if c.ocfg.protocol == "http/json" {
+		d, err := marshalOTLPJSON(req)
+		if err != nil {
+			return fmt.Errorf("unable to encode traces: %s", err)
+		}
+		return c.send(ctx, "application/json", d)
+	}
+
+	d, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("unable to encode traces: %s", err)
+	}
+	return c.send(ctx, "application/x-protobuf", d)
+}
+
+// send POSTs body to the collector, retrying while it asks us to
+func (c *httpClient) send(ctx context.Context, contentType string, body []byte) error {
+	body, err := c.compress(body)
+	if err != nil {
+		return err
+	}
+
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = maxHTTPRetryTime
+
+	for {
+		err := c.post(ctx, contentType, body)
+
+		var retry *retryableError
+		if !errors.As(err, &retry) {
+			return err
+		}
+
+		wait := bo.NextBackOff()
+		if wait == backoff.Stop {
+			return err
+		}
+		if retry.after > wait {
+			wait = retry.after
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *httpClient) compress(d []byte) ([]byte, error) {
+	if c.ocfg.compression != "gzip" {
+		return d, nil
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(d)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to compress traces: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// retryableError is returned for responses the collector expects us to
+// send again, after is how long it asked us to wait
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (c *httpClient) post(ctx context.Context, contentType string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.ocfg.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.ocfg.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range c.ocfg.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.ocfg.compression == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// the collector might be restarting
+		return &retryableError{err: fmt.Errorf("unable to upload traces: %s", err)}
+	}
+	defer resp.Body.Close()
+
+	// keep the connection reusable, and hold on to the start of any error message
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("unable to upload traces: %s: %s", resp.Status, bytes.TrimSpace(msg))
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &retryableError{err: err, after: retryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+	return err
+}
+
+// retryAfter reads a Retry-After header, which is either a number of
+// seconds or a date
+func retryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,52 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// marshalOTLPJSON encodes m the way OTLP/JSON expects, which differs from
+// plain protojson in using enum numbers and hex trace and span ids
+func marshalOTLPJSON(m proto.Message) ([]byte, error) {
+	d, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(d))
+	dec.UseNumber()
+	err = dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(hexIDs(v))
+}
+
+func hexIDs(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			s, ok := field.(string)
+			if ok && (k == "traceId" || k == "spanId" || k == "parentSpanId") {
+				id, err := base64.StdEncoding.DecodeString(s)
+				if err == nil {
+					v[k] = hex.EncodeToString(id)
+				}
+				continue
+			}
+			v[k] = hexIDs(field)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = hexIDs(v[i])
+		}
+	}
+	return v
+}
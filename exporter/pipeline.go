@@ -0,0 +1,112 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// PipelineConfig is read from XOTEL_PIPELINE_<NAME>_*, anything not set
+// falls back to the top level XOTEL_* value
+type PipelineConfig struct {
+	// an xray filter expression, eg service("checkout") AND fault
+	FilterExpression string        `split_words:"true"` // XOTEL_PIPELINE_<NAME>_FILTER_EXPRESSION
+	MaxLookBack      time.Duration `split_words:"true"` // XOTEL_PIPELINE_<NAME>_MAX_LOOK_BACK
+	MinLookBack      time.Duration `split_words:"true"` // XOTEL_PIPELINE_<NAME>_MIN_LOOK_BACK
+	// names of the destinations to send traces to
+	Destination []string // XOTEL_PIPELINE_<NAME>_DESTINATION
+}
+
+// pipeline is a set of traces we poll xray for and where they're sent
+type pipeline struct {
+	name             string
+	filterExpression *string
+	destinations     []*destination
+	// added to the resource of every span this pipeline exports
+	resourceAttrs []*commonpb.KeyValue
+
+	// how far back to look
+	maxLookBack time.Duration
+	// we need to leave at least T -1 minute because some data in
+	// xray might not have loaded into a full trace yet
+	// TODO: double check this is correct
+	minLookBack time.Duration
+}
+
+// envName turns a name from a list like XOTEL_PIPELINES into the form used
+// in the env vars configuring it
+func envName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// getPipelineConfigs returns the pipelines named in XOTEL_PIPELINES, or a
+// single "default" pipeline using the top level config. When polling groups
+// there's no default pipeline, as the groups would export the same traces.
+func getPipelineConfigs(cfg Config) (map[string]PipelineConfig, error) {
+	defaults := PipelineConfig{
+		FilterExpression: cfg.FilterExpression,
+		MaxLookBack:      cfg.MaxLookBack,
+		MinLookBack:      cfg.MinLookBack,
+		Destination:      cfg.Destination,
+	}
+
+	if len(cfg.Pipelines) == 0 {
+		if cfg.PollGroups {
+			return map[string]PipelineConfig{}, nil
+		}
+		return map[string]PipelineConfig{"default": defaults}, nil
+	}
+
+	pipelines := map[string]PipelineConfig{}
+	for _, name := range cfg.Pipelines {
+		pcfg := defaults
+		err := envconfig.Process(fmt.Sprintf("XOTEL_PIPELINE_%s", envName(name)), &pcfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config for pipeline %s: %s", name, err)
+		}
+		pipelines[name] = pcfg
+	}
+
+	return pipelines, nil
+}
+
+func newPipeline(name string, pcfg PipelineConfig, destinations map[string]*destination) (*pipeline, error) {
+	dests, err := lookupDestinations(pcfg.Destination, destinations)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline %s %s", name, err)
+	}
+	if pcfg.MinLookBack >= pcfg.MaxLookBack {
+		return nil, fmt.Errorf("pipeline %s min look back must be less than max look back", name)
+	}
+
+	p := &pipeline{
+		name:         name,
+		destinations: dests,
+		maxLookBack:  pcfg.MaxLookBack * -1,
+		minLookBack:  pcfg.MinLookBack * -1,
+	}
+	if pcfg.FilterExpression != "" {
+		p.filterExpression = &pcfg.FilterExpression
+	}
+
+	return p, nil
+}
+
+func lookupDestinations(names []string, destinations map[string]*destination) ([]*destination, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("has no destinations")
+	}
+
+	dests := []*destination{}
+	for _, name := range names {
+		dest, ok := destinations[name]
+		if !ok {
+			return nil, fmt.Errorf("has unknown destination %s", name)
+		}
+		dests = append(dests, dest)
+	}
+	return dests, nil
+}
@@ -0,0 +1,334 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pollWindow is a single [start, end] query against xray. It tracks the
+// work that query fans out into, so we know when every trace found in the
+// window has made it through the pipeline.
+type pollWindow struct {
+	source   *source
+	pipeline *pipeline
+	// the pipeline's destinations this window is for, or all of them when
+	// nil
+	dests []*destination
+	start time.Time
+	end   time.Time
+	// every trace id sent to be fetched
+	ids []string
+	// fetching partial traces again, rather than polling
+	refetch bool
+
+	pending sync.WaitGroup
+	failed  uint32
+
+	// destinations that didn't get every span, and the ones we've logged
+	// as backed up
+	mu         sync.Mutex
+	destFailed map[string]bool
+	backedUp   map[string]bool
+}
+
+func (w *pollWindow) key() string {
+	return pollKey(w.source, w.pipeline)
+}
+
+func (w *pollWindow) destinations() []*destination {
+	if w.dests == nil {
+		return w.pipeline.destinations
+	}
+	return w.dests
+}
+
+// fail fails the window for every destination
+func (w *pollWindow) fail() {
+	atomic.StoreUint32(&w.failed, 1)
+}
+
+// failDestination fails the window for one destination, the rest can
+// still move on
+func (w *pollWindow) failDestination(dest string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.destFailed == nil {
+		w.destFailed = map[string]bool{}
+	}
+	w.destFailed[dest] = true
+}
+
+// hasFailed is true if any destination didn't get every span
+func (w *pollWindow) hasFailed() bool {
+	if atomic.LoadUint32(&w.failed) == 1 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.destFailed) != 0
+}
+
+func (w *pollWindow) failedFor(dest string) bool {
+	if atomic.LoadUint32(&w.failed) == 1 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.destFailed[dest]
+}
+
+// skip fails the window for a destination that's backed up, it's true the
+// first time so it's only logged once
+func (w *pollWindow) skip(dest string) bool {
+	w.failDestination(dest)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.backedUp[dest] {
+		return false
+	}
+	if w.backedUp == nil {
+		w.backedUp = map[string]bool{}
+	}
+	w.backedUp[dest] = true
+	return true
+}
+
+// poller walks forward through time in contiguous windows, saving a
+// checkpoint for each destination after it has every span in the window,
+// so a restart picks up where the last run left off. A destination that
+// falls behind is polled on its own until it catches up with the rest.
+type poller struct {
+	svc      *Service
+	source   *source
+	pipeline *pipeline
+	key      string
+	// last checkpoint for each destination
+	last map[string]*Checkpoint
+	// failed attempts at each destination's next window
+	attempts map[string]windowAttempts
+}
+
+type windowAttempts struct {
+	start time.Time
+	n     int
+}
+
+// checkpointKey is where dest's checkpoint for the poller with key is
+// saved
+func checkpointKey(key string, dest *destination) string {
+	return key + "@" + dest.name
+}
+
+func (svc *Service) newPoller(ctx context.Context, src *source, pl *pipeline) (*poller, error) {
+	key := pollKey(src, pl)
+	p := &poller{
+		svc:      svc,
+		source:   src,
+		pipeline: pl,
+		key:      key,
+		last:     map[string]*Checkpoint{},
+		attempts: map[string]windowAttempts{},
+	}
+
+	for _, dest := range pl.destinations {
+		last, err := svc.checkpoints.Load(ctx, checkpointKey(key, dest))
+		if err != nil {
+			return nil, err
+		}
+		if last == nil {
+			// saved before each destination had its own checkpoint
+			last, err = svc.checkpoints.Load(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if last != nil {
+			log.Printf("Resuming %s for %s from %s\n", key, dest.name, last.EndTime.Format(time.RFC3339))
+		}
+		p.last[dest.name] = last
+	}
+
+	return p, nil
+}
+
+// run polls every max look back, like the default settings of 6m, until
+// ctx is done. Windows are queried and exported using workCtx, so a window
+// that has started when ctx is done still gets finished.
+func (p *poller) run(ctx context.Context, workCtx context.Context) {
+	ticker := time.NewTicker(p.pipeline.maxLookBack * -1)
+	defer ticker.Stop()
+
+	for {
+		p.catchUp(ctx, workCtx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// catchUp polls every window between the last checkpoints and now, if
+// we've been down for a while this will be several windows in a row. A
+// destination that fails a window waits for the next tick to try it again,
+// the others keep going.
+func (p *poller) catchUp(ctx context.Context, workCtx context.Context) {
+	failed := map[string]bool{}
+	for {
+		p.svc.waitForCapacity(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		w := p.nextWindow(time.Now(), failed)
+		if w == nil {
+			return
+		}
+
+		err := p.poll(workCtx, w)
+		if err != nil {
+			p.svc.errors <- err
+		}
+		for _, dest := range w.dests {
+			if last := p.last[dest.name]; last == nil || !last.EndTime.Equal(w.end) {
+				failed[dest.name] = true
+			}
+		}
+	}
+}
+
+// startFor is where dest's next window starts
+func (p *poller) startFor(dest *destination, now time.Time) time.Time {
+	last := p.last[dest.name]
+	if last == nil {
+		return now.Add(p.pipeline.maxLookBack)
+	}
+
+	earliest := now.Add(p.svc.cfg.MaxCatchUp * -1)
+	if last.EndTime.Before(earliest) {
+		log.Printf(
+			"Checkpoint for %s to %s is older than %s, skipping %s to %s\n",
+			p.key, dest.name, p.svc.cfg.MaxCatchUp, last.EndTime.Format(time.RFC3339), earliest.Format(time.RFC3339),
+		)
+		return earliest
+	}
+	return last.EndTime
+}
+
+// nextWindow is for the destinations that are furthest behind, skipping
+// any that failed. It returns nil when there's nothing new to look at yet.
+func (p *poller) nextWindow(now time.Time, failed map[string]bool) *pollWindow {
+	starts := map[string]time.Time{}
+	var dests []*destination
+	var start time.Time
+	for _, dest := range p.pipeline.destinations {
+		if failed[dest.name] {
+			continue
+		}
+
+		s := p.startFor(dest, now)
+		starts[dest.name] = s
+		switch {
+		case dests == nil || s.Before(start):
+			dests = []*destination{dest}
+			start = s
+		case s.Equal(start):
+			dests = append(dests, dest)
+		}
+	}
+
+	end := now.Add(p.pipeline.minLookBack)
+	if dests == nil || !start.Before(end) {
+		return nil
+	}
+
+	if end.Sub(start) > p.svc.cfg.CatchUpWindow {
+		end = start.Add(p.svc.cfg.CatchUpWindow)
+	}
+	// stop where the next destination is up to, so they're polled together
+	// from there
+	for _, s := range starts {
+		if s.After(start) && s.Before(end) {
+			end = s
+		}
+	}
+
+	return &pollWindow{source: p.source, pipeline: p.pipeline, dests: dests, start: start, end: end}
+}
+
+func (p *poller) poll(ctx context.Context, w *pollWindow) error {
+	p.svc.Debug(fmt.Sprintf("poll %s %s to %s", p.key, w.start.Format(time.RFC3339), w.end.Format(time.RFC3339)))
+
+	err := p.svc.collectAndForwardTraces(ctx, w)
+	if err != nil {
+		w.fail()
+	}
+
+	// wait for everything we found to be uploaded before moving on
+	w.pending.Wait()
+
+	if w.hasFailed() {
+		// so they aren't skipped when we retry this window
+		p.svc.seen.forget(p.key, w.ids)
+	}
+
+	// move each destination that got everything on, even if we can't
+	// persist it, otherwise we'd export this window again on the next tick
+	cp := Checkpoint{StartTime: w.start, EndTime: w.end}
+	failed := []string{}
+	for _, dest := range w.dests {
+		if w.failedFor(dest.name) && !p.giveUp(dest, w) {
+			failed = append(failed, dest.name)
+			continue
+		}
+
+		delete(p.attempts, dest.name)
+		p.last[dest.name] = &cp
+		saveErr := p.svc.checkpoints.Save(ctx, checkpointKey(p.key, dest), cp)
+		if saveErr != nil && err == nil {
+			err = fmt.Errorf("unable to save checkpoint: %s", saveErr)
+		}
+	}
+
+	if len(failed) != 0 && err == nil {
+		err = fmt.Errorf(
+			"failed to export all traces for %s to %s between %s and %s",
+			p.key, strings.Join(failed, ", "), w.start, w.end,
+		)
+	}
+	return err
+}
+
+// giveUp counts a failed attempt at w for dest. It's true once the window
+// has been tried MaxWindowAttempts times, so dest moves on rather than
+// getting stuck on something xray or the destination will never accept.
+func (p *poller) giveUp(dest *destination, w *pollWindow) bool {
+	a := p.attempts[dest.name]
+	if !a.start.Equal(w.start) {
+		a = windowAttempts{start: w.start}
+	}
+	a.n++
+	p.attempts[dest.name] = a
+
+	if p.svc.cfg.MaxWindowAttempts < 1 || a.n < p.svc.cfg.MaxWindowAttempts {
+		return false
+	}
+
+	log.Printf(
+		"Giving up on %s for %s from %s to %s after (%d) attempts, traces in it may be missing\n",
+		p.key, dest.name, w.start.Format(time.RFC3339), w.end.Format(time.RFC3339), a.n,
+	)
+	return true
+}
@@ -0,0 +1,84 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextWindowCatchesUpEachDestination(t *testing.T) {
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	p := &poller{
+		svc: &Service{cfg: Config{CatchUpWindow: 5 * time.Minute, MaxCatchUp: 24 * time.Hour}},
+		pipeline: &pipeline{
+			maxLookBack:  -6 * time.Minute,
+			minLookBack:  -1 * time.Minute,
+			destinations: []*destination{{name: "a"}, {name: "b"}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		aEnd      time.Duration
+		bEnd      time.Duration
+		failed    map[string]bool
+		wantDests string
+		wantStart time.Duration
+		wantEnd   time.Duration
+	}{
+		// b is polled on its own up to where a is
+		{"b behind", -7 * time.Minute, -10 * time.Minute, nil, "b", -10 * time.Minute, -7 * time.Minute},
+		{"caught up", -7 * time.Minute, -7 * time.Minute, nil, "ab", -7 * time.Minute, -2 * time.Minute},
+		{"up to date", -2 * time.Minute, -2 * time.Minute, nil, "ab", -2 * time.Minute, -1 * time.Minute},
+		{"b failed", -7 * time.Minute, -10 * time.Minute, map[string]bool{"b": true}, "a", -7 * time.Minute, -2 * time.Minute},
+		{"nothing new", -1 * time.Minute, -1 * time.Minute, nil, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		p.last = map[string]*Checkpoint{
+			"a": {EndTime: now.Add(tt.aEnd)},
+			"b": {EndTime: now.Add(tt.bEnd)},
+		}
+
+		w := p.nextWindow(now, tt.failed)
+		if w == nil {
+			if tt.wantDests != "" {
+				t.Errorf("%s: no window, want one for %s", tt.name, tt.wantDests)
+			}
+			continue
+		}
+
+		dests := ""
+		for _, dest := range w.dests {
+			dests += dest.name
+		}
+		if dests != tt.wantDests || w.start.Sub(now) != tt.wantStart || w.end.Sub(now) != tt.wantEnd {
+			t.Errorf(
+				"%s: window for %q from %s to %s, want %q from %s to %s", tt.name,
+				dests, w.start.Sub(now), w.end.Sub(now), tt.wantDests, tt.wantStart, tt.wantEnd,
+			)
+		}
+	}
+}
+
+func TestGiveUpAfterMaxWindowAttempts(t *testing.T) {
+	start := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	dest := &destination{name: "default"}
+	p := &poller{
+		svc:      &Service{cfg: Config{MaxWindowAttempts: 3}},
+		key:      "default",
+		attempts: map[string]windowAttempts{},
+	}
+	w := &pollWindow{start: start, end: start.Add(5 * time.Minute)}
+
+	for i, want := range []bool{false, false, true} {
+		if got := p.giveUp(dest, w); got != want {
+			t.Errorf("attempt %d: giveUp = %v, want %v", i+1, got, want)
+		}
+	}
+
+	// a different window starts counting again
+	next := &pollWindow{start: w.end, end: w.end.Add(5 * time.Minute)}
+	if p.giveUp(dest, next) {
+		t.Errorf("gave up on the first attempt at the next window")
+	}
+}
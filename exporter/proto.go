@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	"encoding/hex"
 	"log"
 
 	"github.com/aws/aws-sdk-go-v2/service/xray/types"
@@ -13,37 +14,124 @@ import (
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
-func parseTrace(trace types.Trace) ([]*tracepb.ResourceSpans, error) {
+// translation is what's needed to turn the segments of one trace into spans
+type translation struct {
+	opts translateOptions
+	// every segment and subsegment in the trace by id, so a span can look
+	// at the segments around it
+	segments map[string]*awsxray.Segment
+	// every exception in the trace by id, a segment's cause can be the id
+	// of an exception in one of its subsegments
+	exceptions map[string]*awsxray.Exception
+}
+
+func newTranslation(opts translateOptions, segs []*awsxray.Segment) *translation {
+	tr := &translation{
+		opts:       opts,
+		segments:   map[string]*awsxray.Segment{},
+		exceptions: map[string]*awsxray.Exception{},
+	}
+
+	var add func(seg *awsxray.Segment)
+	add = func(seg *awsxray.Segment) {
+		if seg.ID != nil {
+			tr.segments[*seg.ID] = seg
+		}
+		if seg.Cause != nil {
+			for i, ex := range seg.Cause.Exceptions {
+				if ex.ID != nil {
+					tr.exceptions[*ex.ID] = &seg.Cause.Exceptions[i]
+				}
+			}
+		}
+		for i := range seg.Subsegments {
+			add(&seg.Subsegments[i])
+		}
+	}
+	for _, seg := range segs {
+		add(seg)
+	}
+
+	return tr
+}
+
+// parseTrace converts the trace, leaving out spans whose ids are in
+// exported. Every segment is still used to translate the rest, eg to find a
+// parent, and segments without any spans to export, like ones still in
+// progress, are left out. It also says whether the trace is still partial.
+func parseTrace(trace types.Trace, opts translateOptions, exported map[string]bool) ([]*tracepb.ResourceSpans, bool, error) {
 	rspans := []*tracepb.ResourceSpans{}
 
 	if trace.Id == nil {
 		log.Printf("[skip] trace has no Id")
 	}
+
+	segs := []*awsxray.Segment{}
 	for _, s := range trace.Segments {
 		seg, err := parseSegmentDocument(*s.Document)
 		if err != nil || seg == nil {
 			log.Printf("unable to parse segment for xray trace %s\n%s", *trace.Id, err)
+			continue
 		}
+		segs = append(segs, seg)
+	}
 
-		rspn, err := segmentToResourceSpan(seg)
+	tr := newTranslation(opts, segs)
+	for _, seg := range segs {
+		rspn, err := segmentToResourceSpan(seg, tr)
 		if err != nil {
 			log.Printf("unable to parse segment for xray trace %s\n%s", *trace.Id, err)
-		} else {
-			rspans = append(rspans, rspn...)
+			continue
+		}
+		for _, rs := range rspn {
+			rs = filterSpans(rs, func(span *tracepb.Span) bool {
+				return !exported[hex.EncodeToString(span.SpanId)]
+			})
+			if rs != nil {
+				rspans = append(rspans, rs)
+			}
 		}
 	}
 
-	return rspans, nil
+	return rspans, tr.partial(), nil
+}
+
+// filterSpans returns rs with only the spans keep is true for, or nil if
+// there aren't any
+func filterSpans(rs *tracepb.ResourceSpans, keep func(span *tracepb.Span) bool) *tracepb.ResourceSpans {
+	all := true
+	scopeSpans := []*tracepb.ScopeSpans{}
+	for _, ss := range rs.ScopeSpans {
+		spans := []*tracepb.Span{}
+		for _, span := range ss.Spans {
+			if keep(span) {
+				spans = append(spans, span)
+			} else {
+				all = false
+			}
+		}
+		if len(spans) != 0 {
+			scopeSpans = append(scopeSpans, &tracepb.ScopeSpans{Scope: ss.Scope, Spans: spans, SchemaUrl: ss.SchemaUrl})
+		}
+	}
+
+	if len(scopeSpans) == 0 {
+		return nil
+	}
+	if all {
+		return rs
+	}
+	return &tracepb.ResourceSpans{Resource: rs.Resource, ScopeSpans: scopeSpans, SchemaUrl: rs.SchemaUrl}
 }
 
-func segmentToResourceSpan(seg *awsxray.Segment) ([]*tracepb.ResourceSpans, error) {
+func segmentToResourceSpan(seg *awsxray.Segment, tr *translation) ([]*tracepb.ResourceSpans, error) {
 	rspans := []*tracepb.ResourceSpans{}
 	if seg.Origin == nil {
 		return nil, nil
 	}
 	scopeSpans := []*tracepb.ScopeSpans{}
 
-	spns, err := segmentToSpans(seg, nil, nil)
+	spns, err := segmentToSpans(seg, nil, nil, tr)
 	if err != nil {
 		return nil, err
 	}
@@ -85,7 +173,9 @@ func segmentToResourceSpan(seg *awsxray.Segment) ([]*tracepb.ResourceSpans, erro
 	return rspans, nil
 }
 
-func segmentToSpans(seg *awsxray.Segment, traceId *trace.TraceID, parentId *trace.SpanID) (spans []*tracepb.Span, err error) {
+// segmentToSpans converts a segment and its subsegments, subsegments are
+// given the trace id of the segment they're in
+func segmentToSpans(seg *awsxray.Segment, traceId *trace.TraceID, parentId *trace.SpanID, tr *translation) (spans []*tracepb.Span, err error) {
 	if seg == nil {
 		return nil, nil
 	}
@@ -108,10 +198,6 @@ func segmentToSpans(seg *awsxray.Segment, traceId *trace.TraceID, parentId *trac
 		return nil, err
 	}
 
-	var name = "unknown"
-	if seg.Name != nil {
-		name = *seg.Name
-	}
 	if seg.StartTime == nil || seg.EndTime == nil {
 		log.Println("skip span missing start/end time")
 		return nil, nil
@@ -119,16 +205,24 @@ func segmentToSpans(seg *awsxray.Segment, traceId *trace.TraceID, parentId *trac
 	startTime := uint64(parseXrayTimestamp(*seg.StartTime).UnixNano())
 	endTime := uint64(parseXrayTimestamp(*seg.EndTime).UnixNano())
 
+	kind := tr.spanKind(seg, traceId == nil)
+	attrs := getAttributesFromXraySegment(*seg, kind)
+	name := getSpanName(*seg, kind)
+	if seg.Name != nil && name != *seg.Name {
+		// keep the segment's name, it's often the service
+		attrs = append(attrs, attribute.String("aws.xray.segment.name", *seg.Name))
+	}
+
 	s := &tracepb.Span{
 		TraceId:                tid[:],
 		SpanId:                 spanId[:],
-		Status:                 getStatusFromXraySegment(*seg),
+		Status:                 getStatusFromXraySegment(*seg, kind, tr),
 		StartTimeUnixNano:      startTime,
 		EndTimeUnixNano:        endTime,
-		Kind:                   tracepb.Span_SPAN_KIND_INTERNAL,
+		Kind:                   kind,
 		Name:                   name,
-		Attributes:             KeyValues(getAttributesFromXraySegment(*seg)),
-		Events:                 getEventsFromXraySegment(*seg),
+		Attributes:             KeyValues(attrs),
+		Events:                 getEventsFromXraySegment(*seg, tr, endTime),
 		DroppedAttributesCount: 0,
 		DroppedEventsCount:     0,
 		DroppedLinksCount:      0,
@@ -148,7 +242,7 @@ func segmentToSpans(seg *awsxray.Segment, traceId *trace.TraceID, parentId *trac
 
 	if len(seg.Subsegments) >= 1 {
 		for _, sub := range seg.Subsegments {
-			subspn, err := segmentToSpans(&sub, &tid, &spanId)
+			subspn, err := segmentToSpans(&sub, &tid, &spanId, tr)
 			if err != nil {
 				return nil, err
 			}
@@ -159,3 +253,28 @@ func segmentToSpans(seg *awsxray.Segment, traceId *trace.TraceID, parentId *trac
 	spans = append(spans, s)
 	return spans, nil
 }
+
+// addResourceAttributes adds attrs to each resource, unless it already has
+// a value for that key
+func addResourceAttributes(rspans []*tracepb.ResourceSpans, attrs []*commonpb.KeyValue) {
+	if len(attrs) == 0 {
+		return
+	}
+
+	for _, rs := range rspans {
+		if rs.Resource == nil {
+			rs.Resource = &resourcepb.Resource{}
+		}
+
+		existing := map[string]bool{}
+		for _, kv := range rs.Resource.Attributes {
+			existing[kv.Key] = true
+		}
+
+		for _, kv := range attrs {
+			if !existing[kv.Key] {
+				rs.Resource.Attributes = append(rs.Resource.Attributes, kv)
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// diskQueue keeps batches waiting to be uploaded on disk, one file per
+// batch, so they survive the collector being down or xotel restarting
+type diskQueue struct {
+	dir      string
+	maxBytes int64
+
+	mu sync.Mutex
+	// oldest first
+	files []queuedFile
+	size  int64
+	next  uint64
+
+	// signalled when a batch is pushed or removed
+	pushed  chan struct{}
+	removed chan struct{}
+}
+
+type queuedFile struct {
+	name string
+	size int64
+}
+
+const queueFileExt = ".otlp"
+
+// openDiskQueue picks up any batches left in dir by the last run
+func openDiskQueue(dir string, maxBytes int64) (*diskQueue, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create queue directory: %s", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read queue directory: %s", err)
+	}
+
+	q := &diskQueue{
+		dir:      dir,
+		maxBytes: maxBytes,
+		pushed:   make(chan struct{}, 1),
+		removed:  make(chan struct{}, 1),
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, queueFileExt) {
+			// left over from a write that didn't finish
+			if strings.HasSuffix(name, ".tmp") {
+				os.Remove(filepath.Join(dir, name))
+			}
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, queueFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read queue directory: %s", err)
+		}
+
+		q.files = append(q.files, queuedFile{name: name, size: info.Size()})
+		q.size += info.Size()
+		if seq >= q.next {
+			q.next = seq + 1
+		}
+	}
+
+	// names are zero padded so they sort in the order they were pushed
+	sort.Slice(q.files, func(i, j int) bool { return q.files[i].name < q.files[j].name })
+
+	return q, nil
+}
+
+// len is how many batches are waiting
+func (q *diskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.files)
+}
+
+// push writes a batch to disk. If the queue is full it waits for space,
+// which holds up the pipeline until the destination catches up.
+func (q *diskQueue) push(ctx context.Context, rspans []*tracepb.ResourceSpans) error {
+	d, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: rspans})
+	if err != nil {
+		return fmt.Errorf("unable to encode batch for the queue: %s", err)
+	}
+	size := int64(len(d))
+
+	for {
+		q.mu.Lock()
+		// a batch on its own is always let in, otherwise it could never be sent
+		if q.maxBytes <= 0 || len(q.files) == 0 || q.size+size <= q.maxBytes {
+			break
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("export queue in %s is full", q.dir)
+		case <-q.removed:
+		case <-time.After(time.Second):
+		}
+	}
+	defer q.mu.Unlock()
+
+	name := fmt.Sprintf("%020d%s", q.next, queueFileExt)
+	err = writeFileSync(filepath.Join(q.dir, name), d)
+	if err != nil {
+		return fmt.Errorf("unable to write to the export queue: %s", err)
+	}
+
+	q.next++
+	q.files = append(q.files, queuedFile{name: name, size: size})
+	q.size += size
+	signal(q.pushed)
+
+	return nil
+}
+
+// peek reads the oldest batch, or returns false once ctx is done
+func (q *diskQueue) peek(ctx context.Context) (string, []*tracepb.ResourceSpans, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.files) != 0 {
+			name := q.files[0].name
+			q.mu.Unlock()
+
+			d, err := os.ReadFile(filepath.Join(q.dir, name))
+			var req coltracepb.ExportTraceServiceRequest
+			if err == nil {
+				err = proto.Unmarshal(d, &req)
+			}
+			if err != nil {
+				// it'll never get any better, so skip it
+				log.Printf("Error: dropping unreadable batch %s from the export queue: %s\n", name, err)
+				q.remove(name)
+				continue
+			}
+
+			return name, req.ResourceSpans, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return "", nil, false
+		case <-q.pushed:
+		}
+	}
+}
+
+// remove deletes a batch once it has been uploaded
+func (q *diskQueue) remove(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, f := range q.files {
+		if f.name == name {
+			q.files = append(q.files[:i], q.files[i+1:]...)
+			q.size -= f.size
+			break
+		}
+	}
+
+	os.Remove(filepath.Join(q.dir, name))
+	signal(q.removed)
+}
+
+// sendQueued uploads batches from dest's queue, oldest first, retrying
+// each with backoff until the destination accepts it
+func (svc *Service) sendQueued(ctx context.Context, dest *destination) {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = 0
+	bo.MaxInterval = svc.cfg.ExportRetryMaxInterval
+
+	for {
+		name, rspans, ok := dest.queue.peek(ctx)
+		if !ok {
+			return
+		}
+
+		err := dest.upload(ctx, rspans)
+		if err != nil {
+			wait := bo.NextBackOff()
+			svc.errors <- fmt.Errorf("%s, trying again in %s", err, wait.Round(time.Second))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		bo.Reset()
+		dest.queue.remove(name)
+	}
+}
+
+// waitForQueue waits for dest's queue to be sent, or ctx to be done
+func waitForQueue(ctx context.Context, dest *destination) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for dest.queue.len() != 0 {
+		select {
+		case <-ctx.Done():
+			log.Printf("Leaving (%d) batches in the queue for %s, they'll be sent on restart\n", dest.queue.len(), dest.name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// signal wakes up one waiter on ch without blocking
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// writeFileSync writes then renames, like the checkpoint file, and syncs
+// so the batch is on disk before we tell the poller it's safe
+func writeFileSync(path string, d []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(d)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
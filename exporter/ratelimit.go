@@ -0,0 +1,188 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/xray"
+	"github.com/aws/smithy-go"
+)
+
+// how many times to retry a call xray throttled before giving up on it
+const maxThrottleRetries = 5
+
+// xrayAPI is the part of the xray client we use
+type xrayAPI interface {
+	GetTraceSummaries(ctx context.Context, params *xray.GetTraceSummariesInput, optFns ...func(*xray.Options)) (*xray.GetTraceSummariesOutput, error)
+	BatchGetTraces(ctx context.Context, params *xray.BatchGetTracesInput, optFns ...func(*xray.Options)) (*xray.BatchGetTracesOutput, error)
+	GetGroups(ctx context.Context, params *xray.GetGroupsInput, optFns ...func(*xray.Options)) (*xray.GetGroupsOutput, error)
+}
+
+// rateLimitedXray keeps our calls to each xray operation under a rate, so
+// we leave some of the account's quota for other tools. When xray throttles
+// us the rate for that operation is halved, then slowly recovers as calls
+// succeed (AIMD).
+type rateLimitedXray struct {
+	client *xray.Client
+
+	summaries *tokenBucket
+	traces    *tokenBucket
+	groups    *tokenBucket
+}
+
+func newRateLimitedXray(client *xray.Client, cfg Config) *rateLimitedXray {
+	return &rateLimitedXray{
+		client:    client,
+		summaries: newTokenBucket("GetTraceSummaries", cfg.GetTraceSummariesRPS),
+		traces:    newTokenBucket("BatchGetTraces", cfg.BatchGetTracesRPS),
+		// only called every few minutes, this doesn't need to be configurable
+		groups: newTokenBucket("GetGroups", 1),
+	}
+}
+
+func (x *rateLimitedXray) GetTraceSummaries(ctx context.Context, params *xray.GetTraceSummariesInput, optFns ...func(*xray.Options)) (output *xray.GetTraceSummariesOutput, err error) {
+	err = x.summaries.do(ctx, func() error {
+		output, err = x.client.GetTraceSummaries(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (x *rateLimitedXray) BatchGetTraces(ctx context.Context, params *xray.BatchGetTracesInput, optFns ...func(*xray.Options)) (output *xray.BatchGetTracesOutput, err error) {
+	err = x.traces.do(ctx, func() error {
+		output, err = x.client.BatchGetTraces(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func (x *rateLimitedXray) GetGroups(ctx context.Context, params *xray.GetGroupsInput, optFns ...func(*xray.Options)) (output *xray.GetGroupsOutput, err error) {
+	err = x.groups.do(ctx, func() error {
+		output, err = x.client.GetGroups(ctx, params, optFns...)
+		return err
+	})
+	return output, err
+}
+
+func isThrottle(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		_, ok := retry.DefaultThrottleErrorCodes[apiErr.ErrorCode()]
+		return ok
+	}
+	return false
+}
+
+// tokenBucket allows rate calls per second, with a burst of one second's
+// worth of calls, or one call when the rate is below one a second
+type tokenBucket struct {
+	name    string
+	maxRate float64
+	minRate float64
+
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(name string, rate float64) *tokenBucket {
+	return &tokenBucket{
+		name:    name,
+		maxRate: rate,
+		minRate: rate / 20,
+		rate:    rate,
+		tokens:  math.Max(rate, 1),
+		last:    time.Now(),
+	}
+}
+
+// do calls fn once a token is available, retrying if it was throttled
+func (b *tokenBucket) do(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := b.wait(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = fn()
+		if !isThrottle(err) {
+			if err == nil {
+				b.succeeded()
+			}
+			return err
+		}
+
+		b.throttled()
+		if attempt >= maxThrottleRetries {
+			return err
+		}
+	}
+}
+
+// wait blocks until there is a token to spend
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b.maxRate <= 0 {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		// there's always room for one token, or a rate under one a second
+		// would never have enough for a call
+		if b.tokens > math.Max(b.rate, 1) {
+			b.tokens = math.Max(b.rate, 1)
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (b *tokenBucket) throttled() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rate = b.rate / 2
+	if b.rate < b.minRate {
+		b.rate = b.minRate
+	}
+	// don't let a full bucket undo the slow down
+	if b.tokens > 0 {
+		b.tokens = 0
+	}
+	log.Printf("X-Ray throttled %s, slowing down to %.2f calls/s\n", b.name, b.rate)
+}
+
+func (b *tokenBucket) succeeded() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate < b.maxRate {
+		b.rate += b.maxRate / 20
+		if b.rate > b.maxRate {
+			b.rate = b.maxRate
+		}
+	}
+}
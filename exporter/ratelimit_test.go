@@ -0,0 +1,51 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBelowOneCallASecond(t *testing.T) {
+	b := newTokenBucket("test", 0.5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := b.wait(ctx)
+	if err != nil {
+		t.Fatalf("first call should use the burst: %s", err)
+	}
+
+	// two seconds later there's a token for the next call
+	b.last = b.last.Add(-2 * time.Second)
+	err = b.wait(ctx)
+	if err != nil {
+		t.Fatalf("second call should have a token: %s", err)
+	}
+}
+
+func TestTokenBucketRecoversAfterThrottling(t *testing.T) {
+	b := newTokenBucket("test", 2)
+	b.throttled()
+	b.throttled()
+	if b.rate != 0.5 {
+		t.Fatalf("rate should be halved twice to 0.5, got %v", b.rate)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	b.last = b.last.Add(-2 * time.Second)
+	err := b.wait(ctx)
+	if err != nil {
+		t.Fatalf("should be able to call at 0.5 calls/s: %s", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		b.succeeded()
+	}
+	if b.rate != 2 {
+		t.Fatalf("rate should recover to 2, got %v", b.rate)
+	}
+}
@@ -0,0 +1,289 @@
+package exporter
+
+import (
+	"context"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/xray/types"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// reconciler tracks the spans each destination has accepted for each recent
+// trace. Segments can arrive in xray after we've exported a trace, or finish
+// after being in progress, and subsegments can be added to a segment, so
+// partial traces are fetched again once they've had time to settle. When a
+// trace is fetched again, or its window is retried, each destination only
+// gets the spans it hasn't accepted yet.
+type reconciler struct {
+	settleDelay time.Duration
+	ttl         time.Duration
+	maxTraces   int
+
+	mu     sync.Mutex
+	traces map[string]*trackedTrace // by seenKey
+}
+
+type trackedTrace struct {
+	traceID  string
+	source   *source
+	pipeline *pipeline
+	// the span ids, from segments and subsegments, each destination has
+	// accepted, by destination name
+	accepted map[string]map[string]bool
+	// when to fetch this trace again, zero if it isn't partial
+	refetchAt time.Time
+	// when we started tracking it
+	since   time.Time
+	expires time.Time
+}
+
+func newReconciler(cfg Config) *reconciler {
+	return &reconciler{
+		settleDelay: cfg.ReconcileSettleDelay,
+		ttl:         cfg.ReconcileTTL,
+		maxTraces:   cfg.ReconcileMaxTraces,
+		traces:      map[string]*trackedTrace{},
+	}
+}
+
+// track returns the trace, creating it if there's room. Must hold mu.
+func (r *reconciler) track(w *pollWindow, traceID string, now time.Time) *trackedTrace {
+	key := seenKey(w.key(), traceID)
+	if t, ok := r.traces[key]; ok {
+		return t
+	}
+
+	if len(r.traces) >= r.maxTraces {
+		return nil
+	}
+
+	t := &trackedTrace{
+		traceID:  traceID,
+		source:   w.source,
+		pipeline: w.pipeline,
+		accepted: map[string]map[string]bool{},
+		since:    now,
+		expires:  now.Add(r.ttl),
+	}
+	r.traces[key] = t
+	return t
+}
+
+// partial schedules a trace to be fetched again after the settle delay
+func (r *reconciler) partial(w *pollWindow, traceID string, now time.Time) {
+	if r.settleDelay <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.track(w, traceID, now)
+	if t == nil {
+		return
+	}
+
+	t.refetchAt = now.Add(r.settleDelay)
+	if t.expires.Before(t.refetchAt) {
+		t.expires = t.refetchAt.Add(r.ttl)
+	}
+}
+
+// exported returns the ids of the trace's spans every destination of the
+// window has accepted, and starts tracking the trace if we aren't yet
+func (r *reconciler) exported(w *pollWindow, trace types.Trace, now time.Time) map[string]bool {
+	if trace.Id == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.track(w, *trace.Id, now)
+	if t == nil {
+		return nil
+	}
+
+	// keep it while a failed window is being retried
+	if expires := now.Add(r.ttl); t.expires.Before(expires) {
+		t.expires = expires
+	}
+
+	exported := map[string]bool{}
+	for i, dest := range w.pipeline.destinations {
+		if i == 0 {
+			for id := range t.accepted[dest.name] {
+				exported[id] = true
+			}
+			continue
+		}
+		for id := range exported {
+			if !t.accepted[dest.name][id] {
+				delete(exported, id)
+			}
+		}
+	}
+	return exported
+}
+
+// accept records that dest has uploaded, or queued, the spans
+func (r *reconciler) accept(w *pollWindow, traceID string, rs *tracepb.ResourceSpans, dest string, now time.Time) {
+	if traceID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.track(w, traceID, now)
+	if t == nil {
+		return
+	}
+
+	if t.accepted[dest] == nil {
+		t.accepted[dest] = map[string]bool{}
+	}
+	for _, ss := range rs.ScopeSpans {
+		for _, span := range ss.Spans {
+			t.accepted[dest][hex.EncodeToString(span.SpanId)] = true
+		}
+	}
+}
+
+// unaccepted returns rs without the spans dest already has, or nil if it
+// has them all
+func (r *reconciler) unaccepted(w *pollWindow, traceID string, rs *tracepb.ResourceSpans, dest string) *tracepb.ResourceSpans {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.traces[seenKey(w.key(), traceID)]
+	if !ok {
+		return rs
+	}
+	return filterSpans(rs, func(span *tracepb.Span) bool {
+		return !t.accepted[dest][hex.EncodeToString(span.SpanId)]
+	})
+}
+
+// stillPartial schedules a trace that was partial when we fetched it again
+// to be fetched once more, until the ttl has passed since we started
+// tracking it
+func (r *reconciler) stillPartial(w *pollWindow, traceID string, now time.Time) {
+	if r.settleDelay <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.traces[seenKey(w.key(), traceID)]
+	if !ok {
+		return
+	}
+
+	refetchAt := now.Add(r.settleDelay)
+	if refetchAt.After(t.since.Add(r.ttl)) {
+		return
+	}
+	t.refetchAt = refetchAt
+}
+
+// due returns the traces ready to be fetched again, and drops traces we
+// no longer need to track
+func (r *reconciler) due(now time.Time) []*trackedTrace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := []*trackedTrace{}
+	for key, t := range r.traces {
+		if !t.refetchAt.IsZero() && !now.Before(t.refetchAt) {
+			t.refetchAt = time.Time{}
+			due = append(due, t)
+		}
+
+		if now.After(t.expires) {
+			delete(r.traces, key)
+		}
+	}
+
+	return due
+}
+
+// reconcile checks for partial traces to fetch again every 10 seconds,
+// until ctx is done
+func (svc *Service) reconcile(ctx context.Context) {
+	ticker := time.NewTicker(time.Second * 10)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			svc.refetchPartialTraces()
+		}
+	}
+}
+
+// refetchPartialTraces fetches partial traces again once they've settled,
+// exporting any segments that arrived since, and waits for them to be
+// exported. Traces that are still partial are fetched again after another
+// settle delay, until we stop tracking them.
+func (svc *Service) refetchPartialTraces() {
+	due := svc.reconciler.due(time.Now())
+	if len(due) == 0 {
+		return
+	}
+
+	// group them so each fetch goes to the right account, region and
+	// destination
+	windows := map[string]*pollWindow{}
+	for _, t := range due {
+		w, ok := windows[pollKey(t.source, t.pipeline)]
+		if !ok {
+			w = &pollWindow{source: t.source, pipeline: t.pipeline, refetch: true}
+			windows[w.key()] = w
+		}
+		w.ids = append(w.ids, t.traceID)
+	}
+
+	for key, w := range windows {
+		log.Printf("Fetching (%d) partial traces again for %s\n", len(w.ids), key)
+
+		for _, chunk := range chunkBy(w.ids, 5) {
+			w.pending.Add(1)
+			svc.idChunkChan <- idChunk{ids: chunk, window: w}
+		}
+	}
+
+	now := time.Now()
+	for key, w := range windows {
+		w.pending.Wait()
+
+		if w.hasFailed() {
+			// destinations that accepted them won't get them again
+			log.Printf("Failed to export partial traces for %s, fetching them again later\n", key)
+			for _, traceID := range w.ids {
+				svc.reconciler.stillPartial(w, traceID, now)
+			}
+		}
+	}
+}
+
+// partial is true when a segment is still in progress, or its parent isn't
+// in the trace yet
+func (tr *translation) partial() bool {
+	for _, seg := range tr.segments {
+		if aws.ToBool(seg.InProgress) {
+			return true
+		}
+		if seg.ParentID != nil && tr.segments[*seg.ParentID] == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package exporter
+
+import (
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/xray/types"
+)
+
+func TestReconcileInProgressSegment(t *testing.T) {
+	r := newReconciler(Config{
+		ReconcileSettleDelay: 2 * time.Minute,
+		ReconcileTTL:         15 * time.Minute,
+		ReconcileMaxTraces:   10,
+	})
+	w := &pollWindow{
+		source:   &source{},
+		pipeline: &pipeline{name: "default", destinations: []*destination{{name: "default"}}},
+	}
+	now := time.Now()
+
+	// fetch converts the trace, and has the destination accept every span
+	// it gets, returning their ids
+	fetch := func(docs ...string) ([]string, bool) {
+		trace := types.Trace{Id: aws.String("1-626e5a00-9c3d11223344556677889900")}
+		for _, doc := range docs {
+			trace.Segments = append(trace.Segments, types.Segment{Document: aws.String(doc)})
+		}
+
+		rspans, partial, err := parseTrace(trace, translateOptions{}, r.exported(w, trace, now))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{}
+		for _, rs := range rspans {
+			rs = r.unaccepted(w, *trace.Id, rs, "default")
+			if rs == nil {
+				continue
+			}
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					ids = append(ids, hex.EncodeToString(span.SpanId))
+				}
+			}
+			r.accept(w, *trace.Id, rs, "default", now)
+		}
+		sort.Strings(ids)
+		return ids, partial
+	}
+
+	inProgress := `{"id": "a000000000000001", "trace_id": "1-626e5a00-9c3d11223344556677889900",
+		"name": "checkout", "origin": "AWS::ECS::Container", "start_time": 1651399200, "in_progress": true}`
+	complete := `{"id": "a000000000000001", "trace_id": "1-626e5a00-9c3d11223344556677889900",
+		"name": "checkout", "origin": "AWS::ECS::Container", "start_time": 1651399200, "end_time": 1651399201,
+		"subsegments": [
+			{"id": "b000000000000001", "name": "orders", "start_time": 1651399200.1, "end_time": 1651399200.5}
+		]}`
+	// xray merged a late subsegment into the segment
+	merged := `{"id": "a000000000000001", "trace_id": "1-626e5a00-9c3d11223344556677889900",
+		"name": "checkout", "origin": "AWS::ECS::Container", "start_time": 1651399200, "end_time": 1651399201,
+		"subsegments": [
+			{"id": "b000000000000001", "name": "orders", "start_time": 1651399200.1, "end_time": 1651399200.5},
+			{"id": "b000000000000002", "name": "payments", "start_time": 1651399200.6, "end_time": 1651399200.9}
+		]}`
+
+	tests := []struct {
+		name        string
+		doc         string
+		wantIDs     []string
+		wantPartial bool
+	}{
+		{"in progress", inProgress, []string{}, true},
+		{"complete", complete, []string{"a000000000000001", "b000000000000001"}, false},
+		{"late subsegment", merged, []string{"b000000000000002"}, false},
+		{"nothing new", merged, []string{}, false},
+	}
+
+	for _, tt := range tests {
+		ids, partial := fetch(tt.doc)
+		if !reflect.DeepEqual(ids, tt.wantIDs) {
+			t.Errorf("%s: exported %v, want %v", tt.name, ids, tt.wantIDs)
+		}
+		if partial != tt.wantPartial {
+			t.Errorf("%s: partial = %v, want %v", tt.name, partial, tt.wantPartial)
+		}
+	}
+}
+
+func TestReconcileExportedByEveryDestination(t *testing.T) {
+	r := newReconciler(Config{ReconcileTTL: 15 * time.Minute, ReconcileMaxTraces: 10})
+	w := &pollWindow{
+		source:   &source{},
+		pipeline: &pipeline{name: "default", destinations: []*destination{{name: "a"}, {name: "b"}}},
+	}
+	now := time.Now()
+	trace := types.Trace{Id: aws.String("1-626e5a00-9c3d11223344556677889900")}
+	doc := `{"id": "a000000000000001", "trace_id": "1-626e5a00-9c3d11223344556677889900",
+		"name": "checkout", "origin": "AWS::ECS::Container", "start_time": 1651399200, "end_time": 1651399201}`
+	trace.Segments = []types.Segment{{Document: aws.String(doc)}}
+
+	rspans, _, err := parseTrace(trace, translateOptions{}, r.exported(w, trace, now))
+	if err != nil || len(rspans) != 1 {
+		t.Fatalf("got (%d) resource spans, %v", len(rspans), err)
+	}
+	r.accept(w, *trace.Id, rspans[0], "a", now)
+
+	// b still needs it, so it's converted again, but only sent to b
+	rspans, _, _ = parseTrace(trace, translateOptions{}, r.exported(w, trace, now))
+	if len(rspans) != 1 {
+		t.Fatalf("got (%d) resource spans, want 1", len(rspans))
+	}
+	if r.unaccepted(w, *trace.Id, rspans[0], "a") != nil {
+		t.Errorf("a would get the span again")
+	}
+	if r.unaccepted(w, *trace.Id, rspans[0], "b") == nil {
+		t.Errorf("b wouldn't get the span")
+	}
+
+	r.accept(w, *trace.Id, rspans[0], "b", now)
+	rspans, _, _ = parseTrace(trace, translateOptions{}, r.exported(w, trace, now))
+	if len(rspans) != 0 {
+		t.Errorf("got (%d) resource spans after every destination accepted them", len(rspans))
+	}
+}
@@ -0,0 +1,78 @@
+package exporter
+
+import (
+	"path"
+	"strconv"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// routes decide which spans a destination wants, a destination without
+// any takes everything its pipelines send it
+type routes struct {
+	services   []string
+	attributes map[string]string
+	groups     map[string]bool
+}
+
+func newRoutes(dcfg DestinationConfig) routes {
+	r := routes{
+		services:   dcfg.Services,
+		attributes: dcfg.Attributes,
+		groups:     map[string]bool{},
+	}
+	for _, g := range dcfg.Groups {
+		r.groups[g] = true
+	}
+	return r
+}
+
+// matches is true when the resource passes every route that's set
+func (r routes) matches(resource *resourcepb.Resource) bool {
+	attrs := map[string]string{}
+	for _, kv := range resource.GetAttributes() {
+		attrs[kv.Key] = attributeString(kv.Value)
+	}
+
+	if len(r.services) != 0 {
+		matched := false
+		for _, pattern := range r.services {
+			if ok, _ := path.Match(pattern, attrs["service.name"]); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for k, v := range r.attributes {
+		if attrs[k] != v {
+			return false
+		}
+	}
+
+	if len(r.groups) != 0 && !r.groups[attrs["aws.xray.group.name"]] {
+		return false
+	}
+
+	return true
+}
+
+// attributeString is the value of a simple attribute as a string, so it
+// can be compared with config
+func attributeString(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'f', -1, 64)
+	}
+	return ""
+}
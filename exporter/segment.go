@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,7 +14,6 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"go.opentelemetry.io/otel/trace"
-	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
@@ -55,7 +56,7 @@ func parseXrayTraceID(tid string) (trace.TraceID, error) {
 	return trace.TraceIDFromHex(fmt.Sprintf("%s%s", s[1], s[2]))
 }
 
-func getAttributesFromXraySegment(seg awsxray.Segment) []attribute.KeyValue {
+func getAttributesFromXraySegment(seg awsxray.Segment, kind tracepb.Span_SpanKind) []attribute.KeyValue {
 	attrs := []attribute.KeyValue{
 		semconv.CloudProviderAWS,
 	}
@@ -100,12 +101,7 @@ func getAttributesFromXraySegment(seg awsxray.Segment) []attribute.KeyValue {
 
 	if seg.HTTP != nil {
 		if seg.HTTP.Request != nil {
-			if seg.HTTP.Request.URL != nil {
-				attrs = append(attrs, attribute.KeyValue{
-					Key:   semconv.HTTPURLKey,
-					Value: attribute.StringValue(*seg.HTTP.Request.URL),
-				})
-			}
+			attrs = append(attrs, getHTTPRequestAttributes(*seg.HTTP.Request, kind)...)
 		}
 		if seg.HTTP.Response != nil {
 			if seg.HTTP.Response.Status != nil {
@@ -123,23 +119,19 @@ func getAttributesFromXraySegment(seg awsxray.Segment) []attribute.KeyValue {
 		}
 	}
 
-	if seg.Fault != nil && *seg.Fault {
-		attrs = append(attrs, attribute.KeyValue{
-			Key:   attribute.Key("error"),
-			Value: attribute.BoolValue(true),
-		})
+	if seg.SQL != nil {
+		attrs = append(attrs, getSQLAttributes(*seg.SQL)...)
 	}
-	if seg.Error != nil && *seg.Error {
-		attrs = append(attrs, attribute.KeyValue{
-			Key:   attribute.Key("error"),
-			Value: attribute.BoolValue(true),
-		})
+
+	// kept as they were, so spans can be filtered on them whatever their status
+	if seg.Fault != nil {
+		attrs = append(attrs, attribute.Bool("aws.xray.fault", *seg.Fault))
 	}
-	if seg.Throttle != nil && *seg.Throttle {
-		attrs = append(attrs, attribute.KeyValue{
-			Key:   attribute.Key("aws.throttle"),
-			Value: attribute.BoolValue(true),
-		})
+	if seg.Error != nil {
+		attrs = append(attrs, attribute.Bool("aws.xray.error", *seg.Error))
+	}
+	if seg.Throttle != nil {
+		attrs = append(attrs, attribute.Bool("aws.xray.throttle", *seg.Throttle))
 	}
 
 	if seg.Cause != nil {
@@ -157,7 +149,7 @@ func getAttributesFromXraySegment(seg awsxray.Segment) []attribute.KeyValue {
 		}
 		if seg.Cause.Paths != nil {
 			attrs = append(attrs, attribute.KeyValue{
-				Key:   semconv.ExceptionTypeKey,
+				Key:   attribute.Key("aws.xray.cause.paths"),
 				Value: attribute.StringSliceValue(seg.Cause.Paths),
 			})
 		}
@@ -393,57 +385,259 @@ func getAttributesFromXraySegment(seg awsxray.Segment) []attribute.KeyValue {
 	return attrs
 }
 
-func getStatusFromXraySegment(seg awsxray.Segment) *tracepb.Status {
+// getHTTPRequestAttributes maps the request to the http semantic conventions,
+// the url's host is the peer for calls out, and the host for requests in
+func getHTTPRequestAttributes(req awsxray.RequestData, kind tracepb.Span_SpanKind) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{}
+
+	if req.Method != nil {
+		attrs = append(attrs, semconv.HTTPMethodKey.String(*req.Method))
+	}
+	if req.UserAgent != nil {
+		attrs = append(attrs, semconv.HTTPUserAgentKey.String(*req.UserAgent))
+	}
+	if req.ClientIP != nil {
+		attrs = append(attrs, semconv.HTTPClientIPKey.String(*req.ClientIP))
+		// without x-forwarded-for it's the address that connected to us
+		if req.XForwardedFor == nil || !*req.XForwardedFor {
+			attrs = append(attrs, attribute.String("net.sock.peer.addr", *req.ClientIP))
+		}
+	}
+
+	if req.URL != nil {
+		attrs = append(attrs, semconv.HTTPURLKey.String(*req.URL))
+
+		u, err := url.Parse(*req.URL)
+		if err == nil && u.Host != "" {
+			if u.Scheme != "" {
+				attrs = append(attrs, semconv.HTTPSchemeKey.String(u.Scheme))
+			}
+			if target := u.RequestURI(); target != "" {
+				attrs = append(attrs, semconv.HTTPTargetKey.String(target))
+			}
+
+			port, _ := strconv.Atoi(u.Port())
+			if kind == tracepb.Span_SPAN_KIND_SERVER {
+				attrs = append(attrs, semconv.HTTPHostKey.String(u.Host), semconv.NetHostNameKey.String(u.Hostname()))
+				if port != 0 {
+					attrs = append(attrs, semconv.NetHostPortKey.Int(port))
+				}
+			} else {
+				attrs = append(attrs, semconv.NetPeerNameKey.String(u.Hostname()))
+				if port != 0 {
+					attrs = append(attrs, semconv.NetPeerPortKey.Int(port))
+				}
+			}
+		}
+	}
+
+	return attrs
+}
+
+// getSpanName is the segment's name, except for http servers which are
+// named for the request, eg GET /orders
+func getSpanName(seg awsxray.Segment, kind tracepb.Span_SpanKind) string {
+	name := "unknown"
+	if seg.Name != nil {
+		name = *seg.Name
+	}
+
+	if kind != tracepb.Span_SPAN_KIND_SERVER || seg.HTTP == nil || seg.HTTP.Request == nil {
+		return name
+	}
+	req := seg.HTTP.Request
+	if req.Method == nil || req.URL == nil {
+		return name
+	}
+	u, err := url.Parse(*req.URL)
+	if err != nil {
+		return name
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s %s", *req.Method, path)
+}
+
+// getStatusFromXraySegment sets ERROR for faults (5xx) and throttles (429),
+// and for errors (4xx) depending on XOTEL_ERROR_STATUS and the span's kind
+func getStatusFromXraySegment(seg awsxray.Segment, kind tracepb.Span_SpanKind, tr *translation) *tracepb.Status {
 	status := tracepb.Status{}
-	if seg.Error != nil && *seg.Error {
+
+	switch {
+	case seg.Fault != nil && *seg.Fault:
 		status.Code = tracepb.Status_STATUS_CODE_ERROR
+	case seg.Throttle != nil && *seg.Throttle:
+		status.Code = tracepb.Status_STATUS_CODE_ERROR
+	case seg.Error != nil && *seg.Error:
+		switch tr.opts.errorStatus {
+		case "always":
+			status.Code = tracepb.Status_STATUS_CODE_ERROR
+		case "client":
+			// a server that got a bad request did its job, the caller didn't
+			if kind != tracepb.Span_SPAN_KIND_SERVER {
+				status.Code = tracepb.Status_STATUS_CODE_ERROR
+			}
+		}
+	}
+
+	if status.Code == tracepb.Status_STATUS_CODE_ERROR {
+		status.Message = getStatusMessage(seg, tr)
+		if status.Message == "" && seg.Throttle != nil && *seg.Throttle {
+			status.Message = "throttled"
+		}
 	}
 
 	return &status
 }
 
-func getEventsFromXraySegment(seg awsxray.Segment) []*tracepb.Span_Event {
+// getStatusMessage is the cause's message, or the first exception's
+func getStatusMessage(seg awsxray.Segment, tr *translation) string {
+	if seg.Cause == nil {
+		return ""
+	}
+	if seg.Cause.Message != nil {
+		return *seg.Cause.Message
+	}
+
+	exs := seg.Cause.Exceptions
+	if seg.Cause.Type == awsxray.CauseTypeExceptionID && seg.Cause.ExceptionID != nil {
+		if ex, ok := tr.exceptions[*seg.Cause.ExceptionID]; ok {
+			exs = []awsxray.Exception{*ex}
+		}
+	}
+	if len(exs) == 0 {
+		return ""
+	}
+
+	if exs[0].Message != nil {
+		return *exs[0].Message
+	}
+	if exs[0].Type != nil {
+		return *exs[0].Type
+	}
+	return ""
+}
+
+// getEventsFromXraySegment has an exception event for each exception in the
+// segment's cause, or for the exception in another segment it refers to.
+// Exceptions have no time in xray, so they're at the end of the span, when
+// they were recorded.
+func getEventsFromXraySegment(seg awsxray.Segment, tr *translation, timestamp uint64) []*tracepb.Span_Event {
 	evts := []*tracepb.Span_Event{}
+	if seg.Cause == nil {
+		return evts
+	}
 
-	if seg.Cause != nil && seg.Cause.Exceptions != nil {
-		for _, ex := range seg.Cause.Exceptions {
-			attrs := []*commonpb.KeyValue{}
+	switch seg.Cause.Type {
+	case awsxray.CauseTypeExceptionID:
+		if seg.Cause.ExceptionID == nil {
+			break
+		}
+		ex, ok := tr.exceptions[*seg.Cause.ExceptionID]
+		if !ok {
+			// the segment it's in wasn't in the trace, so all we have is the id
+			ex = &awsxray.Exception{ID: seg.Cause.ExceptionID}
+		}
+		evts = append(evts, getExceptionEvent(*ex, true, timestamp))
 
-			if ex.Message != nil {
-				attrs = append(attrs, &commonpb.KeyValue{
-					Key:   "aws.exception.message",
-					Value: Value(attribute.StringValue(*ex.Message)),
-				})
-			}
-			if ex.Type != nil {
-				attrs = append(attrs, &commonpb.KeyValue{
-					Key:   "aws.exception.type",
-					Value: Value(attribute.StringValue(*ex.Type)),
-				})
-			}
-			if ex.Remote != nil {
-				attrs = append(attrs, &commonpb.KeyValue{
-					Key:   "aws.exception.remote",
-					Value: Value(attribute.BoolValue(*ex.Remote)),
-				})
-			}
-			if ex.Truncated != nil {
-				attrs = append(attrs, &commonpb.KeyValue{
-					Key:   "aws.exception.trucated",
-					Value: Value(attribute.Int64Value(*ex.Truncated)),
-				})
+	case awsxray.CauseTypeObject:
+		// an exception that caused another one in the list was wrapped by
+		// it, so only the outer one escaped
+		causes := map[string]bool{}
+		for _, ex := range seg.Cause.Exceptions {
+			if ex.Cause != nil {
+				causes[*ex.Cause] = true
 			}
-			if ex.Skipped != nil {
-				attrs = append(attrs, &commonpb.KeyValue{
-					Key:   "aws.exception.skipped",
-					Value: Value(attribute.Int64Value(*ex.Skipped)),
-				})
+		}
+		for _, ex := range seg.Cause.Exceptions {
+			escaped := ex.ID == nil || !causes[*ex.ID]
+			evts = append(evts, getExceptionEvent(ex, escaped, timestamp))
+		}
+	}
+
+	return evts
+}
+
+// getExceptionEvent follows the exception semantic conventions, with the
+// exception's id and the id of the exception that caused it to link them
+func getExceptionEvent(ex awsxray.Exception, escaped bool, timestamp uint64) *tracepb.Span_Event {
+	attrs := []attribute.KeyValue{}
+
+	if ex.Type != nil {
+		attrs = append(attrs, semconv.ExceptionTypeKey.String(*ex.Type))
+	}
+	if ex.Message != nil {
+		attrs = append(attrs, semconv.ExceptionMessageKey.String(*ex.Message))
+	}
+	if len(ex.Stack) != 0 {
+		attrs = append(attrs, semconv.ExceptionStacktraceKey.String(getStackTrace(ex)))
+	}
+	attrs = append(attrs, semconv.ExceptionEscapedKey.Bool(escaped))
+
+	if ex.ID != nil {
+		attrs = append(attrs, attribute.String("aws.xray.exception.id", *ex.ID))
+	}
+	if ex.Cause != nil {
+		attrs = append(attrs, attribute.String("aws.xray.exception.cause", *ex.Cause))
+	}
+	if ex.Remote != nil {
+		attrs = append(attrs, attribute.Bool("aws.xray.exception.remote", *ex.Remote))
+	}
+	if ex.Truncated != nil {
+		attrs = append(attrs, attribute.Int64("aws.xray.exception.truncated", *ex.Truncated))
+	}
+	if ex.Skipped != nil {
+		attrs = append(attrs, attribute.Int64("aws.xray.exception.skipped", *ex.Skipped))
+	}
+
+	return &tracepb.Span_Event{
+		TimeUnixNano: timestamp,
+		Name:         semconv.ExceptionEventName,
+		Attributes:   KeyValues(attrs),
+	}
+}
+
+// getStackTrace renders the stack like most languages print one, the type
+// and message then a line for each frame, like "at handler (src/index.js:12)"
+func getStackTrace(ex awsxray.Exception) string {
+	var b strings.Builder
+
+	if ex.Type != nil {
+		b.WriteString(*ex.Type)
+	}
+	if ex.Message != nil {
+		if ex.Type != nil {
+			b.WriteString(": ")
+		}
+		b.WriteString(*ex.Message)
+	}
+
+	for _, frame := range ex.Stack {
+		location := ""
+		if frame.Path != nil {
+			location = *frame.Path
+			if frame.Line != nil {
+				location = fmt.Sprintf("%s:%d", location, *frame.Line)
 			}
+		}
 
-			evts = append(evts, &tracepb.Span_Event{
-				Attributes: attrs,
-			})
+		b.WriteString("\n\tat ")
+		switch {
+		case frame.Label != nil && location != "":
+			fmt.Fprintf(&b, "%s (%s)", *frame.Label, location)
+		case frame.Label != nil:
+			b.WriteString(*frame.Label)
+		default:
+			b.WriteString(location)
 		}
 	}
-	return evts
+
+	if ex.Truncated != nil && *ex.Truncated > 0 {
+		fmt.Fprintf(&b, "\n\t... %d more", *ex.Truncated)
+	}
+
+	return b.String()
 }
@@ -0,0 +1,189 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// testEvents is each of span's events as its attributes
+func testEvents(span *tracepb.Span) []map[string]string {
+	evts := []map[string]string{}
+	for _, evt := range span.Events {
+		attrs := map[string]string{"event": evt.Name}
+		for _, kv := range evt.Attributes {
+			attrs[kv.Key] = attributeString(kv.Value)
+		}
+		evts = append(evts, attrs)
+	}
+	return evts
+}
+
+func TestExceptionEvents(t *testing.T) {
+	thrown := `{"id": "a000000000000001", "name": "checkout", "origin": "AWS::ECS::Container",
+		"cause": {"working_directory": "/app", "exceptions": [
+			{"id": "e000000000000001", "type": "TimeoutError", "message": "timed out", "cause": "e000000000000002",
+				"truncated": 3, "stack": [
+					{"path": "src/index.js", "line": 12, "label": "handler"},
+					{"label": "anonymous"},
+					{"path": "src/db.js"}
+				]},
+			{"id": "e000000000000002", "type": "SocketError", "message": "reset", "remote": true}
+		]}}`
+	// a segment can refer to an exception in another segment by its id
+	referred := `{"id": "a000000000000002", "name": "orders", "origin": "AWS::ECS::Container",
+		"cause": "e000000000000002"}`
+	missing := `{"id": "a000000000000003", "name": "payments", "origin": "AWS::ECS::Container",
+		"cause": "e00000000000000f"}`
+	none := `{"id": "a000000000000004", "name": "render", "origin": "AWS::ECS::Container"}`
+
+	timeout := map[string]string{
+		"event":                        "exception",
+		"exception.type":               "TimeoutError",
+		"exception.message":            "timed out",
+		"exception.stacktrace":         "TimeoutError: timed out\n\tat handler (src/index.js:12)\n\tat anonymous\n\tat src/db.js\n\t... 3 more",
+		"exception.escaped":            "true",
+		"aws.xray.exception.id":        "e000000000000001",
+		"aws.xray.exception.cause":     "e000000000000002",
+		"aws.xray.exception.truncated": "3",
+	}
+	// it caused the timeout, so it didn't escape
+	reset := map[string]string{
+		"event":                     "exception",
+		"exception.type":            "SocketError",
+		"exception.message":         "reset",
+		"exception.escaped":         "false",
+		"aws.xray.exception.id":     "e000000000000002",
+		"aws.xray.exception.remote": "true",
+	}
+	resetReferred := map[string]string{}
+	for k, v := range reset {
+		resetReferred[k] = v
+	}
+	resetReferred["exception.escaped"] = "true"
+
+	tests := []struct {
+		name string
+		docs []string
+		span string
+		want []map[string]string
+	}{
+		{"chained exceptions", []string{thrown}, "a000000000000001", []map[string]string{timeout, reset}},
+		{"exception in another segment", []string{thrown, referred}, "a000000000000002", []map[string]string{resetReferred}},
+		{"exception in another segment that's missing", []string{missing}, "a000000000000003", []map[string]string{{
+			"event":                 "exception",
+			"exception.escaped":     "true",
+			"aws.xray.exception.id": "e00000000000000f",
+		}}},
+		{"no cause", []string{none}, "a000000000000004", []map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		span, ok := testSpans(t, translateOptions{errorStatus: "client"}, tt.docs...)[tt.span]
+		if !ok {
+			t.Errorf("%s: no %s span", tt.name, tt.span)
+			continue
+		}
+		if got := testEvents(span); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events\ngot:  %v\nwant: %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatusPolicy(t *testing.T) {
+	// a server span, and a client span for its call, both with flag set
+	doc := func(flag string) string {
+		return `{"id": "a000000000000001", "name": "checkout", "origin": "AWS::ECS::Container",
+			"http": {"request": {"method": "POST", "url": "https://checkout.internal/"}}, "` + flag + `": true,
+			"subsegments": [{"id": "b000000000000001", "name": "orders.internal", "namespace": "remote", "` + flag + `": true}]}`
+	}
+
+	unset, errored := tracepb.Status_STATUS_CODE_UNSET, tracepb.Status_STATUS_CODE_ERROR
+	tests := []struct {
+		flag        string
+		errorStatus string
+		wantServer  tracepb.Status_StatusCode
+		wantClient  tracepb.Status_StatusCode
+	}{
+		{"fault", "always", errored, errored},
+		{"fault", "never", errored, errored},
+		{"fault", "client", errored, errored},
+		{"throttle", "always", errored, errored},
+		{"throttle", "never", errored, errored},
+		{"throttle", "client", errored, errored},
+		{"error", "always", errored, errored},
+		{"error", "never", unset, unset},
+		// a server that got a bad request did its job
+		{"error", "client", unset, errored},
+	}
+
+	for _, tt := range tests {
+		spans := testSpans(t, translateOptions{errorStatus: tt.errorStatus}, doc(tt.flag))
+		server, client := spans["a000000000000001"], spans["b000000000000001"]
+		if server == nil || client == nil {
+			t.Fatalf("%s with %s: missing spans, got %v", tt.flag, tt.errorStatus, spans)
+		}
+
+		if server.Status.Code != tt.wantServer {
+			t.Errorf("%s with %s: server status %s, want %s", tt.flag, tt.errorStatus, server.Status.Code, tt.wantServer)
+		}
+		if client.Status.Code != tt.wantClient {
+			t.Errorf("%s with %s: client status %s, want %s", tt.flag, tt.errorStatus, client.Status.Code, tt.wantClient)
+		}
+
+		// the flags are kept to filter on, whatever the status
+		for _, span := range []*tracepb.Span{server, client} {
+			found := false
+			for _, kv := range span.Attributes {
+				if kv.Key == "aws.xray."+tt.flag && attributeString(kv.Value) == "true" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%s with %s: %s has no aws.xray.%s attribute", tt.flag, tt.errorStatus, span.Name, tt.flag)
+			}
+		}
+	}
+}
+
+func TestStatusMessage(t *testing.T) {
+	// segment has flag set, and cause when there is one
+	segment := func(flag string, cause string) string {
+		doc := `{"id": "a000000000000001", "name": "checkout", "origin": "AWS::ECS::Container", "` + flag + `": true`
+		if cause != "" {
+			doc += `, "cause": ` + cause
+		}
+		return doc + `}`
+	}
+	thrown := `{"id": "a000000000000002", "name": "orders", "origin": "AWS::ECS::Container",
+		"cause": {"exceptions": [{"id": "e000000000000001", "type": "SocketError", "message": "reset"}]}}`
+
+	tests := []struct {
+		name string
+		docs []string
+		want string
+	}{
+		{"cause message first", []string{segment("fault", `{"message": "upstream failed", "exceptions": [{"message": "timed out"}]}`)}, "upstream failed"},
+		{"then the first exception's message", []string{segment("fault", `{"exceptions": [{"type": "TimeoutError", "message": "timed out"}, {"message": "reset"}]}`)}, "timed out"},
+		{"then its type", []string{segment("fault", `{"exceptions": [{"type": "TimeoutError"}, {"message": "reset"}]}`)}, "TimeoutError"},
+		{"exception in another segment", []string{segment("fault", `"e000000000000001"`), thrown}, "reset"},
+		{"exception in another segment that's missing", []string{segment("fault", `"e00000000000000f"`)}, ""},
+		{"no cause", []string{segment("fault", "")}, ""},
+		{"throttled", []string{segment("throttle", "")}, "throttled"},
+		{"throttled with a cause", []string{segment("throttle", `{"message": "rate exceeded"}`)}, "rate exceeded"},
+		// only an error span gets a message
+		{"not an error", []string{segment("error", `{"message": "bad request"}`)}, ""},
+	}
+
+	for _, tt := range tests {
+		span, ok := testSpans(t, translateOptions{errorStatus: "never"}, tt.docs...)["a000000000000001"]
+		if !ok {
+			t.Errorf("%s: no span", tt.name)
+			continue
+		}
+		if span.Status.Message != tt.want {
+			t.Errorf("%s: status message %q, want %q", tt.name, span.Status.Message, tt.want)
+		}
+	}
+}
@@ -4,35 +4,48 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/xray"
 	"github.com/aws/aws-sdk-go-v2/service/xray/types"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
 type Service struct {
-	cfg    Config
-	xry    *xray.Client
-	otlp   otlptrace.Client
-	errors chan error
+	cfg          Config
+	sources      []*source
+	pipelines    []*pipeline
+	destinations map[string]*destination
+	checkpoints  CheckpointStore
+	seen         *seenTraces
+	reconciler   *reconciler
+	translate    translateOptions
+	// everything that sends work into the pipeline, once these have all
+	// stopped the pipeline is empty
+	producers sync.WaitGroup
+	errors    chan error
 
 	// a channel with a chunk of 5 trace id's, the max we can query
 	// from batch-get-traces
-	idChunkChan chan []string
+	idChunkChan chan idChunk
 
-	traceChan chan types.Trace
-	otlpChan  chan *tracepb.ResourceSpans // TODO: batching? ring buffer?
+	traceChan chan traceWork
+	otlpChan  chan spanWork
+}
+
+// traceWork is a trace fetched from xray waiting to be converted
+type traceWork struct {
+	trace  types.Trace
+	window *pollWindow
+}
 
-	// how far back to look
-	maxLookBack time.Duration
-	// we need to leave at least T -1 minute because some data in
-	// xray might not have loaded into a full trace yet
-	// TODO: double check this is correct
-	minLookBack time.Duration
+// spanWork is a converted segment waiting to be uploaded
+type spanWork struct {
+	rspans  *tracepb.ResourceSpans
+	traceID string
+	window  *pollWindow
 }
 
 func (s *Service) Debug(msg string) {
@@ -53,107 +66,146 @@ func New(ctx context.Context) (*Service, error) {
 	}
 	log.Println("Loaded aws config")
 
-	otlp := newExporterClient(ctx)
-	err = otlp.Start(ctx)
+	checkpoints, err := newCheckpointStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pipelineConfigs, err := getPipelineConfigs(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	translate, err := newTranslateOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, err := newSources(ctx, cfg, awscfg)
+	if err != nil {
+		return nil, err
+	}
+
+	destinations, err := newDestinations(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pipelines := []*pipeline{}
+	for name, pcfg := range pipelineConfigs {
+		pl, err := newPipeline(name, pcfg, destinations)
+		if err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, pl)
+	}
+
 	svc := Service{
-		cfg:         cfg,
-		xry:         xray.NewFromConfig(awscfg),
-		otlp:        otlp,
-		errors:      make(chan error),
-		idChunkChan: make(chan []string),
-		traceChan:   make(chan types.Trace),
-		otlpChan:    make(chan *tracepb.ResourceSpans),
-		maxLookBack: cfg.MaxLookBack * -1,
-		minLookBack: cfg.MinLookBack * -1,
+		cfg:          cfg,
+		sources:      sources,
+		pipelines:    pipelines,
+		destinations: destinations,
+		checkpoints:  checkpoints,
+		seen:         newSeenTraces(cfg.DedupeSize, cfg.DedupeTTL),
+		reconciler:   newReconciler(cfg),
+		translate:    translate,
+		errors:       make(chan error, cfg.QueueSize),
+		idChunkChan:  make(chan idChunk, cfg.QueueSize),
+		traceChan:    make(chan traceWork, cfg.QueueSize),
+		otlpChan:     make(chan spanWork, cfg.QueueSize),
 	}
 	return &svc, nil
 }
 
-// TODO: concurrency is great, but now need to manage getting rate limited
-// TODO: this will ship duplicate traces, can we do better?
+// Run polls xray until ctx is done, then stops polling and waits up to
+// XOTEL_SHUTDOWN_TIMEOUT for everything in flight to be exported.
 func (svc *Service) Run(ctx context.Context) error {
 	svc.Debug("Start run")
-	ticker := time.NewTicker(svc.maxLookBack * -1)
-	updateTicker := time.NewTicker(time.Second * 10)
-
-	var exported uint64
 
-	go func() {
-		err := svc.collectAndForwardTraces(ctx, time.Now().Add(svc.maxLookBack), time.Now().Add(svc.minLookBack))
-
-		if err != nil {
-			svc.errors <- err
-		}
-	}()
-
-	go func() {
-		for {
-			chunk := <-svc.idChunkChan
-			// TODO: track these ID's for say 10 minutes?
-			// if we get the same ones in, ignore them
-			traces, err := svc.processTraceIdChunk(ctx, chunk)
+	pollers := []*poller{}
+	for _, src := range svc.sources {
+		for _, pl := range svc.pipelines {
+			p, err := svc.newPoller(ctx, src, pl)
 			if err != nil {
-				svc.errors <- err
-			} else {
-				for _, t := range traces {
-					svc.traceChan <- t
-				}
+				return fmt.Errorf("unable to load checkpoint: %s", err)
 			}
+			pollers = append(pollers, p)
 		}
-	}()
+	}
 
-	go func() {
-		for {
-			trace := <-svc.traceChan
-			protoSpans, err := parseTrace(trace)
-			if err != nil {
-				svc.errors <- err
-			} else {
+	// ctx stops us starting anything new, workCtx lets what we've started
+	// finish while we shut down
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
 
-				for _, spn := range protoSpans {
+	reportCtx, cancelReport := context.WithCancel(context.Background())
+	defer cancelReport()
+	go svc.report(reportCtx)
 
-					svc.otlpChan <- spn
-				}
-			}
+	svc.startPipeline(workCtx)
+	for _, p := range pollers {
+		p := p
+		log.Printf("Polling %s\n", p.key)
+		svc.startProducer(func() { p.run(ctx, workCtx) })
+	}
+	if svc.cfg.PollGroups {
+		for _, src := range svc.sources {
+			src := src
+			svc.startProducer(func() { svc.watchGroups(ctx, workCtx, src) })
 		}
-	}()
+	}
+	svc.startProducer(func() { svc.reconcile(ctx) })
 
-	go func() {
-		for {
-			rspan := <-svc.otlpChan
-			err := svc.otlp.UploadTraces(ctx, []*tracepb.ResourceSpans{rspan})
-			if err != nil {
-				svc.errors <- err
-			}
+	<-ctx.Done()
+	log.Println("Shutting down, waiting for in flight traces to be exported")
 
-			atomic.AddUint64(&exported, 1)
+	return svc.shutdown(cancelWork)
+}
 
-		}
-	}()
+// report logs errors as they happen, and how much we've exported every
+// 10 seconds, until ctx is done
+func (svc *Service) report(ctx context.Context) {
+	updateTicker := time.NewTicker(time.Second * 10)
+	defer updateTicker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
+
 		case <-updateTicker.C:
+			var exported uint64
+			for _, dest := range svc.destinations {
+				exported += atomic.SwapUint64(&dest.exported, 0) // reset the counter
+			}
 			if exported != 0 {
 				log.Printf("Exported (%d) spans\n", exported)
-				atomic.AddUint64(&exported, -exported) // reset the counter
 			} else {
 				svc.Debug("didn't export any spans")
 			}
 
-		case t := <-ticker.C:
-			go func() {
-				// TODO: record the time of this check to use as the starting point of the next one
-				err := svc.collectAndForwardTraces(ctx, t.Add(svc.maxLookBack), t.Add(svc.minLookBack))
+			hits, misses := svc.seen.stats()
+			if hits != 0 {
+				log.Printf("Skipped (%d) already exported traces, (%d) new\n", hits, misses)
+			}
+
+			if svc.queued() != 0 {
+				log.Printf(
+					"Queued: (%d/%d) id chunks, (%d/%d) traces, (%d/%d) spans\n",
+					len(svc.idChunkChan), cap(svc.idChunkChan),
+					len(svc.traceChan), cap(svc.traceChan),
+					len(svc.otlpChan), cap(svc.otlpChan),
+				)
+			}
 
-				if err != nil {
-					svc.errors <- err
+			for name, dest := range svc.destinations {
+				if len(dest.spans) != 0 {
+					log.Printf("Queued: (%d/%d) spans for %s\n", len(dest.spans), cap(dest.spans), name)
+				}
+				if dest.queue != nil && dest.queue.len() != 0 {
+					log.Printf("Queued: (%d) batches on disk for %s\n", dest.queue.len(), name)
 				}
-			}()
+			}
 
 		case err := <-svc.errors:
 			if err != nil {
@@ -0,0 +1,66 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// startProducer runs fn in a goroutine that shutdown waits for
+func (svc *Service) startProducer(fn func()) {
+	svc.producers.Add(1)
+	go func() {
+		defer svc.producers.Done()
+		fn()
+	}()
+}
+
+// shutdown waits for the producers to finish what they've started, then
+// flushes and stops each destination. If that takes longer than
+// XOTEL_SHUTDOWN_TIMEOUT, cancelWork is called to abandon what's left.
+func (svc *Service) shutdown(cancelWork context.CancelFunc) error {
+	deadline := time.Now().Add(svc.cfg.ShutdownTimeout)
+
+	drained := make(chan struct{})
+	go func() {
+		svc.producers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Println("Pipeline drained")
+	case <-time.After(time.Until(deadline)):
+		cancelWork()
+		return fmt.Errorf("timed out after %s with (%d) items still queued", svc.cfg.ShutdownTimeout, svc.queued())
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	return svc.stopDestinations(ctx)
+}
+
+// stopDestinations flushes anything the clients are holding and closes
+// their connections
+func (svc *Service) stopDestinations(ctx context.Context) error {
+	var failed []string
+	for name, dest := range svc.destinations {
+		dest.batcher.flush(ctx)
+		if dest.queue != nil {
+			waitForQueue(ctx, dest)
+		}
+
+		err := dest.client.Stop(ctx)
+		if err != nil {
+			log.Printf("Error: unable to stop destination %s: %s\n", name, err)
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("unable to stop destinations %v", failed)
+	}
+	return nil
+}
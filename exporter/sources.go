@@ -0,0 +1,168 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/xray"
+	"github.com/kelseyhightower/envconfig"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// AccountConfig is read from XOTEL_ACCOUNT_<NAME>_*
+type AccountConfig struct {
+	// the role xotel assumes to read xray in this account
+	RoleARN    string `required:"true" split_words:"true"` // XOTEL_ACCOUNT_<NAME>_ROLE_ARN
+	ExternalID string `split_words:"true"`                 // XOTEL_ACCOUNT_<NAME>_EXTERNAL_ID
+}
+
+// source is an account and region we poll xray in, each has its own
+// client and rate limits
+type source struct {
+	// empty when we're only polling the default account and region, so
+	// checkpoints from before these were configurable still match
+	name      string
+	region    string
+	accountID string
+	xry       xrayAPI
+	// added to the resource of every span polled from this source
+	resourceAttrs []*commonpb.KeyValue
+}
+
+// newSources returns a source for each region in XOTEL_REGIONS in our own
+// account, unless XOTEL_POLL_OWN_ACCOUNT is false, and in each account in
+// XOTEL_ACCOUNTS and XOTEL_ACCOUNT_ROLE_ARNS. Without regions we poll the
+// default region.
+func newSources(ctx context.Context, cfg Config, awscfg aws.Config) ([]*source, error) {
+	type account struct {
+		name      string
+		accountID string
+		awscfg    aws.Config
+	}
+
+	accounts := []account{}
+	if cfg.PollOwnAccount {
+		// so our own spans get a cloud.account.id to route on too
+		identity, err := sts.NewFromConfig(awscfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get our own account id: %s", err)
+		}
+		accounts = append(accounts, account{accountID: aws.ToString(identity.Account), awscfg: awscfg})
+	} else if len(cfg.Accounts) == 0 && len(cfg.AccountRoleARNs) == 0 {
+		return nil, fmt.Errorf("XOTEL_ACCOUNTS or XOTEL_ACCOUNT_ROLE_ARNS is required when XOTEL_POLL_OWN_ACCOUNT is false")
+	}
+
+	// assumeRole returns the config for polling an account as roleARN
+	assumeRole := func(name string, roleARN string, externalID string) (account, error) {
+		accountID, err := accountIDFromARN(roleARN)
+		if err != nil {
+			return account{}, fmt.Errorf("account %s: %s", name, err)
+		}
+
+		// credentials are fetched, and refreshed, the first time each
+		// account is polled, so a failure only stops polling that account
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awscfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "xotel"
+			if externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+		})
+
+		accountCfg := awscfg.Copy()
+		accountCfg.Credentials = aws.NewCredentialsCache(provider)
+
+		return account{name: name, accountID: accountID, awscfg: accountCfg}, nil
+	}
+
+	for _, name := range cfg.Accounts {
+		var acfg AccountConfig
+		err := envconfig.Process(fmt.Sprintf("XOTEL_ACCOUNT_%s", envName(name)), &acfg)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config for account %s: %s", name, err)
+		}
+
+		a, err := assumeRole(name, acfg.RoleARN, acfg.ExternalID)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+
+	for _, roleARN := range cfg.AccountRoleARNs {
+		name, err := accountIDFromARN(roleARN)
+		if err != nil {
+			return nil, err
+		}
+
+		a, err := assumeRole(name, roleARN, "")
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+
+	sources := []*source{}
+	for _, a := range accounts {
+		if len(cfg.Regions) == 0 {
+			sources = append(sources, newSource(cfg, a.awscfg, a.name, a.accountID))
+			continue
+		}
+
+		for _, region := range cfg.Regions {
+			regionCfg := a.awscfg.Copy()
+			regionCfg.Region = region
+
+			name := region
+			if a.name != "" {
+				name = a.name + "/" + region
+			}
+			sources = append(sources, newSource(cfg, regionCfg, name, a.accountID))
+		}
+	}
+	return sources, nil
+}
+
+func newSource(cfg Config, awscfg aws.Config, name string, accountID string) *source {
+	src := &source{
+		name:      name,
+		region:    awscfg.Region,
+		accountID: accountID,
+		xry:       newRateLimitedXray(xray.NewFromConfig(awscfg), cfg),
+	}
+
+	attrs := []attribute.KeyValue{}
+	if src.region != "" {
+		attrs = append(attrs, semconv.CloudRegionKey.String(src.region))
+	}
+	if src.accountID != "" {
+		attrs = append(attrs, semconv.CloudAccountIDKey.String(src.accountID))
+	}
+	src.resourceAttrs = KeyValues(attrs)
+
+	return src
+}
+
+// accountIDFromARN gets the account id from an arn like
+// arn:aws:iam::123456789012:role/xotel
+func accountIDFromARN(arn string) (string, error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 || parts[0] != "arn" || parts[4] == "" {
+		return "", fmt.Errorf("unable to get account id from role arn %s", arn)
+	}
+	return parts[4], nil
+}
+
+// pollKey identifies a pipeline polling a source, for checkpoints and
+// deduplication
+func pollKey(src *source, pl *pipeline) string {
+	if src.name == "" {
+		return pl.name
+	}
+	return src.name + "/" + pl.name
+}
@@ -0,0 +1,38 @@
+package exporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestNewSourcesFromAccountRoleARNs(t *testing.T) {
+	cfg := Config{
+		AccountRoleARNs: []string{"arn:aws:iam::123456789012:role/xotel", "arn:aws:iam::210987654321:role/xotel"},
+		Regions:         []string{"ap-southeast-2"},
+	}
+
+	sources, err := newSources(context.Background(), cfg, aws.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ name, accountID string }{
+		{"123456789012/ap-southeast-2", "123456789012"},
+		{"210987654321/ap-southeast-2", "210987654321"},
+	}
+	if len(sources) != len(want) {
+		t.Fatalf("got (%d) sources, want (%d)", len(sources), len(want))
+	}
+	for i, src := range sources {
+		if src.name != want[i].name || src.accountID != want[i].accountID || src.region != "ap-southeast-2" {
+			t.Errorf("source %d is %s in %s %s, want %s in %s", i, src.name, src.accountID, src.region, want[i].name, want[i].accountID)
+		}
+	}
+
+	cfg.AccountRoleARNs = []string{"arn:aws:iam:::role/xotel"}
+	if _, err := newSources(context.Background(), cfg, aws.Config{}); err == nil {
+		t.Errorf("no error for a role arn without an account id")
+	}
+}
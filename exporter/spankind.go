@@ -0,0 +1,197 @@
+package exporter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/ojkelly/xray-to-otel/exporter/awsxray"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// translateOptions change how xray segments are turned into spans
+type translateOptions struct {
+	kindOverrides []kindOverride
+	// when segments with error set are ERROR spans
+	errorStatus string
+}
+
+// kindOverride sets the kind of spans whose segment matches pattern
+type kindOverride struct {
+	pattern string
+	kind    tracepb.Span_SpanKind
+}
+
+var spanKindNames = map[string]tracepb.Span_SpanKind{
+	"internal": tracepb.Span_SPAN_KIND_INTERNAL,
+	"server":   tracepb.Span_SPAN_KIND_SERVER,
+	"client":   tracepb.Span_SPAN_KIND_CLIENT,
+	"producer": tracepb.Span_SPAN_KIND_PRODUCER,
+	"consumer": tracepb.Span_SPAN_KIND_CONSUMER,
+}
+
+func newTranslateOptions(cfg Config) (translateOptions, error) {
+	opts := translateOptions{errorStatus: cfg.ErrorStatus}
+
+	switch cfg.ErrorStatus {
+	case "always", "never", "client":
+	default:
+		return opts, fmt.Errorf("unsupported error status: %s", cfg.ErrorStatus)
+	}
+
+	for _, o := range cfg.SpanKindOverrides {
+		// split on the last colon, so patterns can match origins like AWS::Lambda
+		i := strings.LastIndex(o, ":")
+		if i == -1 {
+			return opts, fmt.Errorf("span kind override %s should be pattern:kind", o)
+		}
+
+		kind, ok := spanKindNames[strings.ToLower(o[i+1:])]
+		if !ok {
+			return opts, fmt.Errorf("span kind override %s has unknown kind %s", o, o[i+1:])
+		}
+		if _, err := path.Match(o[:i], ""); err != nil {
+			return opts, fmt.Errorf("span kind override %s has a bad pattern: %s", o, err)
+		}
+
+		opts.kindOverrides = append(opts.kindOverrides, kindOverride{pattern: o[:i], kind: kind})
+	}
+
+	return opts, nil
+}
+
+// overrideKind is the kind from the first override matching the segment's
+// name, name.operation or origin
+func (opts translateOptions) overrideKind(seg *awsxray.Segment) (tracepb.Span_SpanKind, bool) {
+	names := []string{aws.ToString(seg.Name)}
+	if seg.AWS != nil && seg.AWS.Operation != nil {
+		names = append(names, aws.ToString(seg.Name)+"."+*seg.AWS.Operation)
+	}
+	if seg.Origin != nil {
+		names = append(names, *seg.Origin)
+	}
+
+	for _, o := range opts.kindOverrides {
+		for _, name := range names {
+			if ok, _ := path.Match(o.pattern, name); ok {
+				return o.kind, true
+			}
+		}
+	}
+	return tracepb.Span_SPAN_KIND_UNSPECIFIED, false
+}
+
+// producerOperations are the calls that send a message for something else
+// to pick up, by lower case service and operation
+var producerOperations = map[string]map[string]bool{
+	"sqs":     {"sendmessage": true, "sendmessagebatch": true},
+	"sns":     {"publish": true, "publishbatch": true},
+	"kinesis": {"putrecord": true, "putrecords": true},
+}
+
+// eventSourceOrigins are services that invoke lambda functions with events
+var eventSourceOrigins = []string{
+	"AWS::SQS",
+	"AWS::SNS",
+	"AWS::Kinesis",
+	"AWS::Events",
+	"AWS::S3",
+}
+
+// spanKind works out the kind of span from where the segment is in the
+// trace, unless it's overridden
+func (tr *translation) spanKind(seg *awsxray.Segment, topLevel bool) tracepb.Span_SpanKind {
+	if kind, ok := tr.opts.overrideKind(seg); ok {
+		return kind
+	}
+
+	if !topLevel {
+		if seg.SQL != nil {
+			return tracepb.Span_SPAN_KIND_CLIENT
+		}
+		switch aws.ToString(seg.Namespace) {
+		case "aws":
+			if isProducer(seg) {
+				return tracepb.Span_SPAN_KIND_PRODUCER
+			}
+			return tracepb.Span_SPAN_KIND_CLIENT
+		case "remote":
+			return tracepb.Span_SPAN_KIND_CLIENT
+		}
+		return tracepb.Span_SPAN_KIND_INTERNAL
+	}
+
+	if isLambda(seg) && tr.invokedByEventSource(seg, 0) {
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	}
+	if isLambda(seg) || (seg.HTTP != nil && seg.HTTP.Request != nil) {
+		return tracepb.Span_SPAN_KIND_SERVER
+	}
+	return tracepb.Span_SPAN_KIND_INTERNAL
+}
+
+// triggerOperations are the calls, in lower case, that pick up events from a
+// queue or stream for a function
+var triggerOperations = map[string]bool{
+	"receivemessage": true,
+	"getrecords":     true,
+}
+
+// invokedByEventSource is true for lambda segments started by a queue,
+// stream or notification, rather than called directly. It needs to see the
+// event source in the trace or the segment's aws data, a lambda with no
+// parent could just as well have been invoked by a client that isn't traced.
+func (tr *translation) invokedByEventSource(seg *awsxray.Segment, depth int) bool {
+	if hasTrigger(seg) {
+		return true
+	}
+	if seg.ParentID == nil {
+		return false
+	}
+
+	parent, ok := tr.segments[*seg.ParentID]
+	if !ok {
+		return false
+	}
+
+	// a function's segment is the child of the lambda service's segment,
+	// which has the parent we want
+	if isLambda(parent) && depth < 2 {
+		return tr.invokedByEventSource(parent, depth+1)
+	}
+
+	if isProducer(parent) {
+		return true
+	}
+	for _, origin := range eventSourceOrigins {
+		if strings.HasPrefix(aws.ToString(parent.Origin), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTrigger is true when the segment's aws data shows it picked up events
+// from a queue or stream
+func hasTrigger(seg *awsxray.Segment) bool {
+	if seg.AWS == nil {
+		return false
+	}
+	if seg.AWS.QueueURL != nil {
+		return true
+	}
+	return triggerOperations[strings.ToLower(aws.ToString(seg.AWS.Operation))]
+}
+
+func isLambda(seg *awsxray.Segment) bool {
+	return strings.HasPrefix(aws.ToString(seg.Origin), "AWS::Lambda")
+}
+
+func isProducer(seg *awsxray.Segment) bool {
+	if seg.AWS == nil || seg.AWS.Operation == nil {
+		return false
+	}
+	ops := producerOperations[strings.ToLower(aws.ToString(seg.Name))]
+	return ops[strings.ToLower(*seg.AWS.Operation)]
+}
@@ -0,0 +1,115 @@
+package exporter
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/xray/types"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// testSpans translates a trace's segment documents and returns the spans
+// by id. Every segment and subsegment, written starting with its id, gets
+// the same times so the documents only need what's being tested.
+func testSpans(t *testing.T, opts translateOptions, docs ...string) map[string]*tracepb.Span {
+	traceID := "1-626e5a00-9c3d11223344556677889900"
+	trace := types.Trace{Id: aws.String(traceID)}
+	for _, doc := range docs {
+		doc = strings.ReplaceAll(doc, `{"id":`, `{"start_time": 1651399200, "end_time": 1651399201, "id":`)
+		doc = strings.Replace(doc, `{`, `{"trace_id": "`+traceID+`", `, 1)
+		trace.Segments = append(trace.Segments, types.Segment{Document: aws.String(doc)})
+	}
+
+	rspans, _, err := parseTrace(trace, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]*tracepb.Span{}
+	for _, rs := range rspans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				spans[hex.EncodeToString(span.SpanId)] = span
+			}
+		}
+	}
+	return spans
+}
+
+func TestSpanKind(t *testing.T) {
+	// a lambda function's segment is the child of the lambda service's
+	lambda := func(parent string) []string {
+		parentID := ""
+		if parent != "" {
+			parentID = `"parent_id": "` + parent + `", `
+		}
+		return []string{
+			`{"id": "c000000000000001", ` + parentID + `"name": "worker", "origin": "AWS::Lambda"}`,
+			`{"id": "c000000000000002", "parent_id": "c000000000000001", "name": "worker-function", "origin": "AWS::Lambda::Function"}`,
+		}
+	}
+	withLambda := func(parent string, docs ...string) []string {
+		return append(docs, lambda(parent)...)
+	}
+
+	publisher := `{"id": "a000000000000001", "name": "checkout", "origin": "AWS::ECS::Container",
+		"http": {"request": {"method": "POST", "url": "https://checkout.internal/"}},
+		"subsegments": [
+			{"id": "b000000000000001", "name": "SNS", "namespace": "aws", "aws": {"operation": "Publish"}},
+			{"id": "b000000000000002", "name": "DynamoDB", "namespace": "aws", "aws": {"operation": "GetItem"}},
+			{"id": "b000000000000003", "name": "orders.internal", "namespace": "remote"},
+			{"id": "b000000000000004", "name": "orders@db.internal", "sql": {"url": "db.internal"}},
+			{"id": "b000000000000005", "name": "render"}
+		]}`
+	queue := `{"id": "a000000000000002", "name": "orders-queue", "origin": "AWS::SQS::Queue"}`
+	poller := `{"id": "c000000000000003", "name": "poller", "origin": "AWS::Lambda::Function",
+		"aws": {"operation": "ReceiveMessage"}}`
+
+	tests := []struct {
+		name      string
+		docs      []string
+		overrides []string
+		span      string
+		want      tracepb.Span_SpanKind
+	}{
+		{"http request", []string{publisher}, nil, "a000000000000001", tracepb.Span_SPAN_KIND_SERVER},
+		{"publish", []string{publisher}, nil, "b000000000000001", tracepb.Span_SPAN_KIND_PRODUCER},
+		{"aws call", []string{publisher}, nil, "b000000000000002", tracepb.Span_SPAN_KIND_CLIENT},
+		{"remote call", []string{publisher}, nil, "b000000000000003", tracepb.Span_SPAN_KIND_CLIENT},
+		{"sql query", []string{publisher}, nil, "b000000000000004", tracepb.Span_SPAN_KIND_CLIENT},
+		{"local work", []string{publisher}, nil, "b000000000000005", tracepb.Span_SPAN_KIND_INTERNAL},
+
+		{"lambda from a publish", withLambda("b000000000000001", publisher), nil, "c000000000000001", tracepb.Span_SPAN_KIND_CONSUMER},
+		{"function from a publish", withLambda("b000000000000001", publisher), nil, "c000000000000002", tracepb.Span_SPAN_KIND_CONSUMER},
+		{"function from a queue", withLambda("a000000000000002", queue), nil, "c000000000000002", tracepb.Span_SPAN_KIND_CONSUMER},
+		{"function reading a queue", []string{poller}, nil, "c000000000000003", tracepb.Span_SPAN_KIND_CONSUMER},
+		// without the event source in the trace it could have been called
+		// directly
+		{"function from a client", withLambda("b000000000000003", publisher), nil, "c000000000000002", tracepb.Span_SPAN_KIND_SERVER},
+		{"function with no parent", lambda(""), nil, "c000000000000002", tracepb.Span_SPAN_KIND_SERVER},
+		{"function with a missing parent", lambda("d000000000000001"), nil, "c000000000000002", tracepb.Span_SPAN_KIND_SERVER},
+
+		{"override by origin", withLambda("a000000000000002", queue), []string{"AWS::Lambda*:server"}, "c000000000000002", tracepb.Span_SPAN_KIND_SERVER},
+		{"override by operation", []string{publisher}, []string{"DynamoDB.GetItem:internal"}, "b000000000000002", tracepb.Span_SPAN_KIND_INTERNAL},
+		{"override by name", []string{publisher}, []string{"orders.*:producer"}, "b000000000000003", tracepb.Span_SPAN_KIND_PRODUCER},
+		{"first override wins", []string{publisher}, []string{"SNS:client", "SNS*:internal"}, "b000000000000001", tracepb.Span_SPAN_KIND_CLIENT},
+	}
+
+	for _, tt := range tests {
+		opts, err := newTranslateOptions(Config{ErrorStatus: "client", SpanKindOverrides: tt.overrides})
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		span, ok := testSpans(t, opts, tt.docs...)[tt.span]
+		if !ok {
+			t.Errorf("%s: no %s span", tt.name, tt.span)
+			continue
+		}
+		if span.Kind != tt.want {
+			t.Errorf("%s: %s is %s, want %s", tt.name, tt.span, span.Kind, tt.want)
+		}
+	}
+}
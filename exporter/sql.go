@@ -0,0 +1,297 @@
+package exporter
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ojkelly/xray-to-otel/exporter/awsxray"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// dbSystems maps xray's database_type, in lower case, to db.system
+var dbSystems = map[string]string{
+	"postgresql":           "postgresql",
+	"postgres":             "postgresql",
+	"mysql":                "mysql",
+	"mariadb":              "mariadb",
+	"oracle":               "oracle",
+	"microsoft sql server": "mssql",
+	"sql server":           "mssql",
+	"sqlserver":            "mssql",
+	"mssql":                "mssql",
+	"db2":                  "db2",
+	"h2":                   "h2",
+	"hsqldb":               "hsqldb",
+	"hsql database engine": "hsqldb",
+	"apache derby":         "derby",
+	"derby":                "derby",
+	"sqlite":               "sqlite",
+	"redshift":             "redshift",
+	"cockroachdb":          "cockroachdb",
+}
+
+// getSQLAttributes maps the sql a subsegment ran to the database semantic
+// conventions. Where the database is comes from the url or connection string,
+// without any credentials in it.
+func getSQLAttributes(sql awsxray.SQLData) []attribute.KeyValue {
+	conn := sqlConnection{}
+	if sql.URL != nil {
+		conn = parseSQLURL(*sql.URL)
+	} else if sql.ConnectionString != nil {
+		conn = parseSQLConnectionString(*sql.ConnectionString)
+	}
+
+	system := conn.system
+	if sql.DatabaseType != nil {
+		system = strings.ToLower(*sql.DatabaseType)
+	}
+	dbSystem := semconv.DBSystemOtherSQL
+	if s, ok := dbSystems[system]; ok {
+		dbSystem = semconv.DBSystemKey.String(s)
+	}
+	attrs := []attribute.KeyValue{dbSystem}
+
+	if conn.name != "" {
+		attrs = append(attrs, semconv.DBNameKey.String(conn.name))
+	}
+	if sql.User != nil {
+		attrs = append(attrs, semconv.DBUserKey.String(*sql.User))
+	} else if conn.user != "" {
+		attrs = append(attrs, semconv.DBUserKey.String(conn.user))
+	}
+	if sql.SanitizedQuery != nil {
+		attrs = append(attrs, semconv.DBStatementKey.String(*sql.SanitizedQuery))
+		if op := sqlOperation(*sql.SanitizedQuery); op != "" {
+			attrs = append(attrs, semconv.DBOperationKey.String(op))
+		}
+	}
+	if conn.sanitized != "" {
+		attrs = append(attrs, semconv.DBConnectionStringKey.String(conn.sanitized))
+	}
+	if conn.host != "" {
+		attrs = append(attrs, semconv.NetPeerNameKey.String(conn.host))
+	}
+	if conn.port != 0 {
+		attrs = append(attrs, semconv.NetPeerPortKey.Int(conn.port))
+	}
+
+	if sql.DatabaseVersion != nil {
+		attrs = append(attrs, attribute.String("db.version", *sql.DatabaseVersion))
+	}
+	if sql.DriverVersion != nil {
+		attrs = append(attrs, attribute.String("db.driver.version", *sql.DriverVersion))
+	}
+	if sql.Preparation != nil {
+		attrs = append(attrs, attribute.String("db.preparation", *sql.Preparation))
+	}
+
+	return attrs
+}
+
+// sqlConnection is where a query was run, from a url or connection string
+type sqlConnection struct {
+	system string
+	host   string
+	port   int
+	name   string
+	user   string
+	// the url or connection string without credentials
+	sanitized string
+}
+
+// parseSQLURL reads urls like postgresql://user@host:5432/database, with or
+// without a jdbc: prefix, and sql server's jdbc urls with ;key=value settings
+// after the host, like sqlserver://host:1433;databaseName=orders
+func parseSQLURL(raw string) sqlConnection {
+	conn := sqlConnection{}
+
+	prefix := ""
+	if strings.HasPrefix(raw, "jdbc:") {
+		prefix, raw = "jdbc:", strings.TrimPrefix(raw, "jdbc:")
+	}
+
+	// sql server's jdbc urls have ;key=value settings after the host, which
+	// can have a / or @ in them, so they're split off first
+	settings := ""
+	if i := strings.Index(raw, "://"); i != -1 {
+		authority := raw[i+3:]
+		if end := strings.IndexAny(authority, "/?#"); end != -1 {
+			authority = authority[:end]
+		}
+		hostStart := strings.LastIndex(authority, "@") + 1
+		if semi := strings.Index(authority[hostStart:], ";"); semi != -1 {
+			cut := i + 3 + hostStart + semi
+			raw, settings = raw[:cut], raw[cut+1:]
+		}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || strings.ContainsAny(u.Host+u.User.Username(), ";=") {
+		// we can't tell what's in it, so leave it out in case it has a password
+		return conn
+	}
+
+	conn.system = u.Scheme
+	conn.host = u.Hostname()
+	conn.port, _ = strconv.Atoi(u.Port())
+	conn.name = strings.TrimPrefix(u.Path, "/")
+	conn.user = u.User.Username()
+
+	u.User = nil
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			if isSQLSecret(k) {
+				q.Del(k)
+			} else if k == "user" && conn.user == "" {
+				conn.user = q.Get(k)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	conn.sanitized = prefix + u.String()
+
+	if settings != "" {
+		kept := conn.readSettings(splitSQLConnectionString(settings))
+		if len(kept) != 0 {
+			conn.sanitized += ";" + strings.Join(kept, ";")
+		}
+	}
+
+	return conn
+}
+
+// parseSQLConnectionString reads key=value;key=value connection strings,
+// like Server=tcp:host,1433;Database=orders;User Id=app;Password=...
+func parseSQLConnectionString(raw string) sqlConnection {
+	conn := sqlConnection{}
+	if strings.Contains(raw, "://") {
+		return parseSQLURL(raw)
+	}
+
+	conn.sanitized = strings.Join(conn.readSettings(splitSQLConnectionString(raw)), ";")
+
+	return conn
+}
+
+// readSettings reads where the database is from key=value settings, and
+// returns the settings without any credentials
+func (conn *sqlConnection) readSettings(parts []string) []string {
+	kept := []string{}
+	afterSecret := false
+	for _, part := range parts {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.TrimSpace(kv[1])
+		if isSQLSecret(key) {
+			afterSecret = true
+			continue
+		}
+		// an unquoted secret with a ; in it looks like more parts, so after
+		// a secret we only keep the parts we know
+		if afterSecret && !sqlConnectionKeys[key] {
+			continue
+		}
+		kept = append(kept, strings.TrimSpace(part))
+
+		switch key {
+		case "server", "servername", "data source", "host", "address", "addr", "network address":
+			// sql server's host is [tcp:]host[\instance][,port]
+			host := strings.TrimPrefix(value, "tcp:")
+			if i := strings.LastIndex(host, ","); i != -1 {
+				conn.port, _ = strconv.Atoi(host[i+1:])
+				host = host[:i]
+			}
+			if i := strings.Index(host, "\\"); i != -1 {
+				host = host[:i]
+			}
+			conn.host = host
+		case "port", "portnumber":
+			conn.port, _ = strconv.Atoi(value)
+		case "database", "databasename", "initial catalog", "dbname":
+			conn.name = value
+		case "user id", "uid", "user", "username":
+			conn.user = value
+		}
+	}
+
+	return kept
+}
+
+// sqlConnectionKeys are the keys we read where a database is from
+var sqlConnectionKeys = map[string]bool{
+	"server":          true,
+	"servername":      true,
+	"data source":     true,
+	"host":            true,
+	"address":         true,
+	"addr":            true,
+	"network address": true,
+	"port":            true,
+	"portnumber":      true,
+	"database":        true,
+	"databasename":    true,
+	"initial catalog": true,
+	"dbname":          true,
+	"user id":         true,
+	"uid":             true,
+	"user":            true,
+	"username":        true,
+}
+
+// sqlSecretWords are in the names of keys that hold credentials, like
+// password, sslpassword, pwd, client_secret, accesstoken or sslkey
+var sqlSecretWords = []string{"pass", "pwd", "secret", "token", "key"}
+
+func isSQLSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range sqlSecretWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSQLConnectionString splits on ; except inside values quoted with
+// ', " or {}
+func splitSQLConnectionString(raw string) []string {
+	parts := []string{}
+	start := 0
+	var closing rune
+	for i, r := range raw {
+		switch {
+		case closing != 0:
+			if r == closing {
+				closing = 0
+			}
+		case r == '\'' || r == '"':
+			closing = r
+		case r == '{':
+			closing = '}'
+		case r == ';':
+			parts = append(parts, raw[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, raw[start:])
+}
+
+// sqlOperation is the first word of the query, eg SELECT
+func sqlOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	for _, r := range fields[0] {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return ""
+		}
+	}
+	return strings.ToUpper(fields[0])
+}
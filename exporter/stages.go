@@ -0,0 +1,216 @@
+package exporter
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// startPipeline starts the workers that take trace ids through to
+// uploaded spans. Each stage reads from a buffered queue so a slow upload
+// doesn't stop us fetching and converting traces, until the queues fill.
+func (svc *Service) startPipeline(ctx context.Context) {
+	startWorkers(svc.cfg.FetchWorkers, func() { svc.fetchTraces(ctx) })
+	startWorkers(svc.cfg.ConvertWorkers, func() { svc.convertTraces(ctx) })
+	startWorkers(svc.cfg.UploadWorkers, func() { svc.routeSpans(ctx) })
+
+	for _, dest := range svc.destinations {
+		dest := dest
+		go svc.batchSpans(ctx, dest)
+		dest.batcher.start(ctx, svc.cfg.UploadWorkers)
+		if dest.queue != nil {
+			go svc.sendQueued(ctx, dest)
+		}
+	}
+}
+
+func startWorkers(n int, fn func()) {
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		go fn()
+	}
+}
+
+// fetchTraces gets the full traces for each chunk of ids
+func (svc *Service) fetchTraces(ctx context.Context) {
+	for {
+		chunk := <-svc.idChunkChan
+		traces, err := svc.processTraceIdChunk(ctx, chunk)
+		if err != nil {
+			chunk.window.fail()
+			svc.errors <- err
+		}
+		// export what we did get, so a retry only needs the rest
+		for _, t := range traces {
+			chunk.window.pending.Add(1)
+			svc.traceChan <- traceWork{trace: t, window: chunk.window}
+		}
+		chunk.window.pending.Done()
+	}
+}
+
+// convertTraces turns xray traces into otel spans
+func (svc *Service) convertTraces(ctx context.Context) {
+	for {
+		work := <-svc.traceChan
+		exported := svc.reconciler.exported(work.window, work.trace, time.Now())
+
+		protoSpans, partial, err := parseTrace(work.trace, svc.translate, exported)
+		if err != nil {
+			work.window.fail()
+			svc.errors <- err
+		} else {
+			traceID := aws.ToString(work.trace.Id)
+			if partial && traceID != "" {
+				if work.window.refetch {
+					svc.reconciler.stillPartial(work.window, traceID, time.Now())
+				} else {
+					svc.reconciler.partial(work.window, traceID, time.Now())
+				}
+			}
+
+			addResourceAttributes(protoSpans, work.window.pipeline.resourceAttrs)
+			addResourceAttributes(protoSpans, work.window.source.resourceAttrs)
+
+			for _, spn := range protoSpans {
+				work.window.pending.Add(1)
+				svc.otlpChan <- spanWork{rspans: spn, traceID: traceID, window: work.window}
+			}
+		}
+		work.window.pending.Done()
+	}
+}
+
+// routeSpans sends spans to each of the window's destinations that wants
+// them and doesn't have them already. When there's more than one, a
+// destination that stays backed up for destinationWait is skipped rather
+// than holding up the rest, it falls behind and is polled on its own until
+// it catches up.
+func (svc *Service) routeSpans(ctx context.Context) {
+	for {
+		work := <-svc.otlpChan
+
+		dests := []*destination{}
+		destWork := []spanWork{}
+		for _, dest := range work.window.destinations() {
+			if !dest.routes.matches(work.rspans.Resource) {
+				continue
+			}
+			rspans := svc.reconciler.unaccepted(work.window, work.traceID, work.rspans, dest.name)
+			if rspans == nil {
+				continue
+			}
+			dests = append(dests, dest)
+			destWork = append(destWork, spanWork{rspans: rspans, traceID: work.traceID, window: work.window})
+		}
+
+		for i, dest := range dests {
+			work.window.pending.Add(1)
+			if len(dests) == 1 {
+				dest.spans <- destWork[i]
+				continue
+			}
+
+			if !sendWithin(dest.spans, destWork[i], destinationWait) {
+				work.window.pending.Done()
+				if work.window.skip(dest.name) {
+					log.Printf("Destination %s is backed up, it'll get these spans when it catches up\n", dest.name)
+				}
+			}
+		}
+		work.window.pending.Done()
+	}
+}
+
+// destinationWait is how long a destination's queue can be full before
+// it's skipped
+const destinationWait = 10 * time.Second
+
+// sendWithin is false if the queue is still full after wait
+func sendWithin(spans chan spanWork, work spanWork, wait time.Duration) bool {
+	select {
+	case spans <- work:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case spans <- work:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// batchSpans adds spans to the next batch for dest
+func (svc *Service) batchSpans(ctx context.Context, dest *destination) {
+	for {
+		work := <-dest.spans
+		w := work.window
+		dest.batcher.add(work.rspans, func(err error) {
+			if err != nil {
+				w.failDestination(dest.name)
+				svc.errors <- err
+			} else {
+				svc.reconciler.accept(w, work.traceID, work.rspans, dest.name, time.Now())
+			}
+			w.pending.Done()
+		})
+	}
+}
+
+// queued is how much work is waiting in the pipeline
+func (svc *Service) queued() int {
+	n := len(svc.idChunkChan) + len(svc.traceChan) + len(svc.otlpChan)
+	for _, dest := range svc.destinations {
+		n += len(dest.spans)
+	}
+	return n
+}
+
+// backedUp is true when a shared queue, or every destination's queue, is
+// over 80% full, we hold off polling for more traces until it's drained.
+// One destination being backed up doesn't stop the rest getting traces.
+func (svc *Service) backedUp() bool {
+	full := func(depth int, size int) bool {
+		return depth*10 >= size*8
+	}
+
+	allFull := len(svc.destinations) != 0
+	for _, dest := range svc.destinations {
+		if !full(len(dest.spans), cap(dest.spans)) {
+			allFull = false
+		}
+	}
+
+	return allFull ||
+		full(len(svc.idChunkChan), cap(svc.idChunkChan)) ||
+		full(len(svc.traceChan), cap(svc.traceChan)) ||
+		full(len(svc.otlpChan), cap(svc.otlpChan))
+}
+
+// waitForCapacity blocks while the pipeline is backed up
+func (svc *Service) waitForCapacity(ctx context.Context) {
+	if !svc.backedUp() {
+		return
+	}
+
+	log.Println("Pipeline is backed up, waiting before polling")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for svc.backedUp() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -4,24 +4,27 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/xray"
 	"github.com/aws/aws-sdk-go-v2/service/xray/types"
+	"github.com/cenkalti/backoff/v4"
 )
 
+// idChunk is a set of trace ids to fetch together, and the window they
+// were found in
+type idChunk struct {
+	ids    []string
+	window *pollWindow
+}
+
 func (svc *Service) processTraceSummaryOutput(
 	ctx context.Context,
-	startTime time.Time,
-	endTime time.Time,
+	w *pollWindow,
 	output *xray.GetTraceSummariesOutput,
 ) (err error) {
 	svc.Debug("processTraceSummaryOutput")
 
-	var wg sync.WaitGroup
-	defer wg.Wait()
-
 	if output == nil {
 		return fmt.Errorf("no output from trace summary api call")
 	}
@@ -31,36 +34,97 @@ func (svc *Service) processTraceSummaryOutput(
 		return nil
 	}
 
-	ids := make([]string, len(output.TraceSummaries))
-	for i, ts := range output.TraceSummaries {
-		ids[i] = *ts.Id
+	now := time.Now()
+	ids := make([]string, 0, len(output.TraceSummaries))
+	for _, ts := range output.TraceSummaries {
+		if svc.seen.check(w.key(), *ts.Id, ts.Revision, now) {
+			continue
+		}
+		if ts.IsPartial != nil && *ts.IsPartial {
+			svc.reconciler.partial(w, *ts.Id, now)
+		}
+		ids = append(ids, *ts.Id)
 	}
 	if svc.cfg.Debug {
-		log.Printf("Found (%d) trace ids\n", len(ids))
+		log.Printf("Found (%d) trace ids, (%d) already exported\n", len(ids), len(output.TraceSummaries)-len(ids))
+	}
+	if len(ids) == 0 {
+		return nil
 	}
+	w.ids = append(w.ids, ids...)
+
 	chunks := chunkBy(ids, 5) // 5 is the max ids allowed to BatchGetTraces call
 
 	for _, chunk := range chunks {
-		svc.idChunkChan <- chunk
+		w.pending.Add(1)
+		svc.idChunkChan <- idChunk{ids: chunk, window: w}
 	}
 
-	if output.NextToken != nil {
-		// TODO: confirm this is actually getting the next page when there's many of them
-		err := svc.readTracesNextPage(ctx, startTime, endTime, *output.NextToken)
+	return nil
+}
+
+// processTraceIdChunk fetches every page of the chunk's traces. Ids xray
+// didn't process are asked for again with backoff, keeping the traces it
+// did return. If some are still missing they're an error along with the
+// traces we have, so the window is tried again rather than checkpointed
+// without them.
+func (svc *Service) processTraceIdChunk(ctx context.Context, chunk idChunk) ([]types.Trace, error) {
+	traces := []types.Trace{}
+	ids := chunk.ids
+
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = maxUnprocessedRetryTime
+
+	for {
+		found, unprocessed, err := batchGetTraces(ctx, chunk.window.source.xry, ids)
+		traces = append(traces, found...)
 		if err != nil {
-			svc.errors <- err
+			return traces, err
 		}
+		if len(unprocessed) == 0 {
+			return traces, nil
+		}
+
+		wait := bo.NextBackOff()
+		if wait == backoff.Stop {
+			return traces, fmt.Errorf("xray didn't return (%d) traces for %s", len(unprocessed), chunk.window.key())
+		}
+		svc.Debug(fmt.Sprintf("xray didn't return (%d) traces, trying again in %s", len(unprocessed), wait))
+
+		select {
+		case <-ctx.Done():
+			return traces, ctx.Err()
+		case <-time.After(wait):
+		}
+		ids = unprocessed
 	}
-	return nil
 }
 
-func (svc *Service) processTraceIdChunk(ctx context.Context, ids []string) ([]types.Trace, error) {
-	batchGetTracesOutput, err := svc.xry.BatchGetTraces(ctx, &xray.BatchGetTracesInput{
-		TraceIds: ids,
-	})
-	if err != nil {
-		return nil, err
-	}
+// maxUnprocessedRetryTime is how long we keep asking for traces xray
+// didn't process
+const maxUnprocessedRetryTime = 30 * time.Second
 
-	return batchGetTracesOutput.Traces, nil
+// batchGetTraces fetches every page of ids, returning the ids xray didn't
+// process
+func batchGetTraces(ctx context.Context, xry xrayAPI, ids []string) ([]types.Trace, []string, error) {
+	traces := []types.Trace{}
+	unprocessed := []string{}
+
+	var nextToken *string
+	for {
+		batchGetTracesOutput, err := xry.BatchGetTraces(ctx, &xray.BatchGetTracesInput{
+			TraceIds:  ids,
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return traces, nil, err
+		}
+		traces = append(traces, batchGetTracesOutput.Traces...)
+		unprocessed = append(unprocessed, batchGetTracesOutput.UnprocessedTraceIds...)
+
+		if batchGetTracesOutput.NextToken == nil {
+			return traces, unprocessed, nil
+		}
+		nextToken = batchGetTracesOutput.NextToken
+	}
 }
@@ -0,0 +1,60 @@
+package exporter
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/xray"
+	"github.com/aws/aws-sdk-go-v2/service/xray/types"
+)
+
+// unprocessedXray leaves the first id it's asked for unprocessed, until
+// it's been asked for it stuck times
+type unprocessedXray struct {
+	xrayAPI
+	stuck int
+	asked [][]string
+}
+
+func (x *unprocessedXray) BatchGetTraces(ctx context.Context, in *xray.BatchGetTracesInput, optFns ...func(*xray.Options)) (*xray.BatchGetTracesOutput, error) {
+	x.asked = append(x.asked, in.TraceIds)
+
+	out := &xray.BatchGetTracesOutput{}
+	for i, id := range in.TraceIds {
+		if i == 0 && len(x.asked) <= x.stuck {
+			out.UnprocessedTraceIds = append(out.UnprocessedTraceIds, id)
+			continue
+		}
+		out.Traces = append(out.Traces, types.Trace{Id: aws.String(id)})
+	}
+	return out, nil
+}
+
+func TestProcessTraceIdChunkRetriesUnprocessed(t *testing.T) {
+	xry := &unprocessedXray{stuck: 2}
+	svc := &Service{}
+	w := &pollWindow{source: &source{xry: xry}, pipeline: &pipeline{name: "default"}}
+
+	traces, err := svc.processTraceIdChunk(context.Background(), idChunk{ids: []string{"1-a", "1-b", "1-c"}, window: w})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, trace := range traces {
+		ids = append(ids, *trace.Id)
+	}
+	sort.Strings(ids)
+	if want := []string{"1-a", "1-b", "1-c"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got traces %v, want %v", ids, want)
+	}
+
+	// only the unprocessed id is asked for again
+	want := [][]string{{"1-a", "1-b", "1-c"}, {"1-a"}, {"1-a"}}
+	if !reflect.DeepEqual(xry.asked, want) {
+		t.Errorf("asked for %v, want %v", xry.asked, want)
+	}
+}
@@ -2,58 +2,41 @@ package exporter
 
 import (
 	"context"
-	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/xray"
 )
 
+// collectAndForwardTraces reads every page of trace summaries in the window
+// and sends the ids off to be fetched.
 func (svc *Service) collectAndForwardTraces(
 	ctx context.Context,
-	startTime time.Time,
-	endTime time.Time,
+	w *pollWindow,
 ) error {
 	svc.Debug("collectAndForwardTraces")
 
-	output, err := svc.xry.GetTraceSummaries(ctx, &xray.GetTraceSummariesInput{
-		StartTime: aws.Time(startTime),
-		EndTime:   aws.Time(endTime),
-	})
-	if err != nil {
-		svc.errors <- err
+	var nextToken *string
+	for {
+		output, err := w.source.xry.GetTraceSummaries(ctx, &xray.GetTraceSummariesInput{
+			StartTime:        aws.Time(w.start),
+			EndTime:          aws.Time(w.end),
+			FilterExpression: w.pipeline.filterExpression,
+			NextToken:        nextToken,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = svc.processTraceSummaryOutput(ctx, w, output)
+		if err != nil {
+			return err
+		}
+
+		if output.NextToken == nil {
+			return nil
+		}
+		nextToken = output.NextToken
 	}
-
-	err = svc.processTraceSummaryOutput(ctx, startTime, endTime, output)
-
-	if err != nil {
-		svc.errors <- err
-	}
-
-	return nil
-}
-
-func (svc *Service) readTracesNextPage(
-	ctx context.Context,
-	startTime time.Time,
-	endTime time.Time,
-	nextToken string,
-) error {
-	svc.Debug("readTracesNextPage")
-
-	output, err := svc.xry.GetTraceSummaries(ctx, &xray.GetTraceSummariesInput{
-		StartTime: aws.Time(startTime),
-		EndTime:   aws.Time(endTime),
-		NextToken: &nextToken,
-	})
-	if err != nil {
-		return err
-	}
-	err = svc.processTraceSummaryOutput(ctx, startTime, endTime, output)
-
-	if err != nil {
-		return err
-	}
-	return nil
 }
 
 func chunkBy(items []string, chunkSize int) (chunks [][]string) {
@@ -0,0 +1,228 @@
+package exporter
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// zipkinClient POSTs spans to a Zipkin collector as v2 JSON
+type zipkinClient struct {
+	*httpClient
+}
+
+func newZipkinClient(endpoint string, ocfg otlpConfig) (*zipkinClient, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("a zipkin endpoint must be a url, like http://localhost:9411/api/v2/spans")
+	}
+
+	ocfg.url = endpoint
+	return &zipkinClient{httpClient: newHTTPClient(ocfg)}, nil
+}
+
+func (c *zipkinClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	d, err := json.Marshal(toZipkinSpans(protoSpans))
+	if err != nil {
+		return fmt.Errorf("unable to encode traces: %s", err)
+	}
+
+	return c.send(ctx, "application/json", d)
+}
+
+// https://zipkin.io/zipkin-api/#/default/post_spans
+type zipkinSpan struct {
+	TraceID        string             `json:"traceId"`
+	ID             string             `json:"id"`
+	ParentID       string             `json:"parentId,omitempty"`
+	Name           string             `json:"name,omitempty"`
+	Kind           string             `json:"kind,omitempty"`
+	Timestamp      uint64             `json:"timestamp,omitempty"`
+	Duration       uint64             `json:"duration,omitempty"`
+	LocalEndpoint  *zipkinEndpoint    `json:"localEndpoint,omitempty"`
+	RemoteEndpoint *zipkinEndpoint    `json:"remoteEndpoint,omitempty"`
+	Annotations    []zipkinAnnotation `json:"annotations,omitempty"`
+	Tags           map[string]string  `json:"tags,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	Port        int64  `json:"port,omitempty"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp uint64 `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+var zipkinKinds = map[tracepb.Span_SpanKind]string{
+	tracepb.Span_SPAN_KIND_SERVER:   "SERVER",
+	tracepb.Span_SPAN_KIND_CLIENT:   "CLIENT",
+	tracepb.Span_SPAN_KIND_PRODUCER: "PRODUCER",
+	tracepb.Span_SPAN_KIND_CONSUMER: "CONSUMER",
+}
+
+func toZipkinSpans(rspans []*tracepb.ResourceSpans) []zipkinSpan {
+	zspans := []zipkinSpan{}
+
+	for _, rs := range rspans {
+		// zipkin has nowhere else to put the resource, so it's added to
+		// the tags of each span
+		serviceName := ""
+		resourceTags := map[string]string{}
+		for _, kv := range rs.Resource.GetAttributes() {
+			if kv.Key == "service.name" {
+				serviceName = attributeString(kv.Value)
+				continue
+			}
+			resourceTags[kv.Key] = tagValue(kv.Value)
+		}
+
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				zs := toZipkinSpan(span)
+				zs.LocalEndpoint = &zipkinEndpoint{ServiceName: serviceName}
+
+				for k, v := range resourceTags {
+					if _, ok := zs.Tags[k]; !ok {
+						zs.Tags[k] = v
+					}
+				}
+				if ss.Scope.GetName() != "" {
+					zs.Tags["otel.library.name"] = ss.Scope.GetName()
+				}
+				if ss.Scope.GetVersion() != "" {
+					zs.Tags["otel.library.version"] = ss.Scope.GetVersion()
+				}
+
+				zspans = append(zspans, zs)
+			}
+		}
+	}
+
+	return zspans
+}
+
+func toZipkinSpan(span *tracepb.Span) zipkinSpan {
+	zs := zipkinSpan{
+		TraceID:   hex.EncodeToString(span.TraceId),
+		ID:        hex.EncodeToString(span.SpanId),
+		ParentID:  hex.EncodeToString(span.ParentSpanId),
+		Name:      span.Name,
+		Kind:      zipkinKinds[span.Kind],
+		Timestamp: span.StartTimeUnixNano / 1000,
+		Tags:      map[string]string{},
+	}
+	if span.EndTimeUnixNano > span.StartTimeUnixNano {
+		zs.Duration = (span.EndTimeUnixNano - span.StartTimeUnixNano) / 1000
+	}
+
+	attrs := map[string]*commonpb.AnyValue{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+		zs.Tags[kv.Key] = tagValue(kv.Value)
+	}
+	zs.RemoteEndpoint = zipkinRemoteEndpoint(span.Kind, attrs)
+
+	switch span.Status.GetCode() {
+	case tracepb.Status_STATUS_CODE_ERROR:
+		zs.Tags["otel.status_code"] = "ERROR"
+		// zipkin treats any span with an error tag as failed
+		zs.Tags["error"] = "true"
+		if span.Status.GetMessage() != "" {
+			zs.Tags["error"] = span.Status.GetMessage()
+		}
+	case tracepb.Status_STATUS_CODE_OK:
+		zs.Tags["otel.status_code"] = "OK"
+	}
+
+	for _, evt := range span.Events {
+		value := evt.Name
+		if len(evt.Attributes) != 0 {
+			evtAttrs := map[string]string{}
+			for _, kv := range evt.Attributes {
+				evtAttrs[kv.Key] = tagValue(kv.Value)
+			}
+			d, _ := json.Marshal(evtAttrs)
+			value = string(d)
+			if evt.Name != "" {
+				value = fmt.Sprintf("%s: %s", evt.Name, d)
+			}
+		}
+
+		ts := evt.TimeUnixNano
+		if ts == 0 {
+			ts = span.StartTimeUnixNano
+		}
+		zs.Annotations = append(zs.Annotations, zipkinAnnotation{
+			Timestamp: ts / 1000,
+			Value:     value,
+		})
+	}
+
+	return zs
+}
+
+// zipkinRemoteEndpoint is the other side of the call, from the network,
+// http and database attributes
+func zipkinRemoteEndpoint(kind tracepb.Span_SpanKind, attrs map[string]*commonpb.AnyValue) *zipkinEndpoint {
+	get := func(keys ...string) string {
+		for _, k := range keys {
+			if v := attributeString(attrs[k]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	ep := &zipkinEndpoint{
+		ServiceName: get("peer.service", "net.peer.name", "db.name"),
+	}
+
+	ip := net.ParseIP(get("net.sock.peer.addr", "net.peer.ip", "http.client_ip"))
+	if ip.To4() != nil {
+		ep.IPv4 = ip.String()
+	} else if ip != nil {
+		ep.IPv6 = ip.String()
+	}
+
+	if port, err := strconv.ParseInt(get("net.peer.port", "net.sock.peer.port"), 10, 64); err == nil {
+		ep.Port = port
+	}
+
+	// calls out to other services have the host in the url
+	if ep.ServiceName == "" && (kind == tracepb.Span_SPAN_KIND_CLIENT || get("aws.namespace") == "remote") {
+		if u, err := url.Parse(get("http.url")); err == nil {
+			ep.ServiceName = u.Hostname()
+		}
+	}
+
+	if *ep == (zipkinEndpoint{}) {
+		return nil
+	}
+	return ep
+}
+
+// tagValue is an attribute as a string, lists are sent as json
+func tagValue(v *commonpb.AnyValue) string {
+	arr, ok := v.GetValue().(*commonpb.AnyValue_ArrayValue)
+	if !ok {
+		return attributeString(v)
+	}
+
+	values := []string{}
+	for _, av := range arr.ArrayValue.GetValues() {
+		values = append(values, attributeString(av))
+	}
+	d, _ := json.Marshal(values)
+	return string(d)
+}
@@ -0,0 +1,98 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestZipkinUploadTraces(t *testing.T) {
+	srv, got := newCaptureServer(t)
+
+	c, err := newZipkinClient(srv.URL+"/api/v2/spans", otlpConfig{
+		headers: map[string]string{"x-api-key": "secret"},
+		timeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rspans := testResourceSpans(
+		testKV("http.method", attribute.StringValue("POST")),
+		testKV("http.url", attribute.StringValue("https://orders.internal/orders")),
+		testKV("net.sock.peer.addr", attribute.StringValue("10.0.0.5")),
+		testKV("net.peer.port", attribute.Int64Value(443)),
+		testKV("aws.xray.cause.paths", attribute.StringSliceValue([]string{"/a", "/b"})),
+	)
+
+	err = c.UploadTraces(context.Background(), rspans)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType := got.header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("content type = %q", contentType)
+	}
+	if apiKey := got.header.Get("x-api-key"); apiKey != "secret" {
+		t.Errorf("x-api-key header = %q", apiKey)
+	}
+
+	want := `[
+		{
+			"traceId": "626e9c1a4a5e2b1f9c3d112233445566",
+			"id": "0102030405060708",
+			"parentId": "0a0b0c0d0e0f1011",
+			"name": "orders",
+			"kind": "CLIENT",
+			"timestamp": 1651399200000000,
+			"duration": 25000,
+			"localEndpoint": {"serviceName": "checkout"},
+			"remoteEndpoint": {"serviceName": "orders.internal", "ipv4": "10.0.0.5", "port": 443},
+			"annotations": [
+				{"timestamp": 1651399200020000, "value": "exception: {\"exception.type\":\"TimeoutError\"}"}
+			],
+			"tags": {
+				"http.method": "POST",
+				"http.url": "https://orders.internal/orders",
+				"net.sock.peer.addr": "10.0.0.5",
+				"net.peer.port": "443",
+				"aws.xray.cause.paths": "[\"/a\",\"/b\"]",
+				"cloud.region": "ap-southeast-2",
+				"otel.library.name": "X-Ray for Go",
+				"otel.library.version": "1.7.0",
+				"otel.status_code": "ERROR",
+				"error": "timed out"
+			}
+		},
+		{
+			"traceId": "626e9c1a4a5e2b1f9c3d112233445566",
+			"id": "0a0b0c0d0e0f1011",
+			"name": "checkout",
+			"kind": "SERVER",
+			"timestamp": 1651399200000000,
+			"duration": 30000,
+			"localEndpoint": {"serviceName": "checkout"},
+			"tags": {
+				"cloud.region": "ap-southeast-2",
+				"otel.library.name": "X-Ray for Go",
+				"otel.library.version": "1.7.0",
+				"otel.status_code": "OK"
+			}
+		}
+	]`
+
+	var posted, expected interface{}
+	if err := json.Unmarshal(got.body, &posted); err != nil {
+		t.Fatalf("posted body isn't json: %s\n%s", err, got.body)
+	}
+	if err := json.Unmarshal([]byte(want), &expected); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(posted, expected) {
+		t.Errorf("posted spans don't match\ngot:  %s\nwant: %s", got.body, want)
+	}
+}